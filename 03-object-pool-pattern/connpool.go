@@ -0,0 +1,184 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+连接池
+设计思想：
+
+	连接是最常见的池化资源：建立成本高(握手、认证)、必须显式关闭、数量要受服务端限制，正好是 ObjectPool 擅长的
+	ConnPool 在 ObjectPool 上加了连接特有的逻辑：
+	1.用调用方提供的 Dial 建立连接，销毁时关闭连接
+	2.借出空闲连接前用 HealthCheck 检查，连接在池子里放着的时候可能已经被对端关掉了
+	3.连接存活超过 MaxLifetime 后不再借出，归还时直接关闭，避免长期持有被中间设备悄悄断开的连接
+	4.Get 返回的 PooledConn 包装了连接，Close 时把连接还给池子而不是关闭它，
+	  调用方照常 defer conn.Close() 就行；读写出错或者调用 MarkBroken 后，Close 会真正关闭连接
+	每次借出都返回一个新的 PooledConn，连接还回去之后旧的句柄就失效了，
+	重复 Close 或者还回去之后继续读写会返回 net.ErrClosed，不会影响正在使用这个连接的其他人
+*/
+
+// 建立连接
+type Dialer func(ctx context.Context) (net.Conn, error)
+
+// 连接池的配置，只有 Dial 是必填的
+type ConnPoolConfig struct {
+	Dial         Dialer
+	HealthCheck  func(conn net.Conn) error // 借出空闲连接前检查，返回错误时关闭并换一个
+	MaxSize      int
+	MinIdle      int
+	IdleTimeout  time.Duration
+	MaxLifetime  time.Duration // 连接建立后最多使用多久，不大于0时不限制
+	ReapInterval time.Duration
+}
+
+// 池子里的一条连接
+type connEntry struct {
+	conn    net.Conn
+	created time.Time
+}
+
+type ConnPool struct {
+	cfg  ConnPoolConfig
+	pool *ObjectPool[*connEntry]
+}
+
+var _ Interface[*PooledConn] = (*ConnPool)(nil)
+
+func NewConnPool(cfg ConnPoolConfig) (*ConnPool, error) {
+	if cfg.Dial == nil {
+		return nil, errors.New("pool: ConnPoolConfig.Dial is required")
+	}
+	cp := &ConnPool{cfg: cfg}
+	pool, err := NewObjectPool(Config[*connEntry]{
+		New: func(ctx context.Context) (*connEntry, error) {
+			conn, err := cfg.Dial(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return &connEntry{conn: conn, created: time.Now()}, nil
+		},
+		Destroy: func(e *connEntry) {
+			_ = e.conn.Close()
+		},
+		OnBorrow: func(e *connEntry) bool {
+			if cp.expired(e) {
+				return false
+			}
+			return cfg.HealthCheck == nil || cfg.HealthCheck(e.conn) == nil
+		},
+		OnReturn: func(e *connEntry) bool {
+			return !cp.expired(e)
+		},
+		MaxSize:      cfg.MaxSize,
+		MinIdle:      cfg.MinIdle,
+		IdleTimeout:  cfg.IdleTimeout,
+		ReapInterval: cfg.ReapInterval,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cp.pool = pool
+	return cp, nil
+}
+
+func (cp *ConnPool) expired(e *connEntry) bool {
+	return cp.cfg.MaxLifetime > 0 && time.Since(e.created) >= cp.cfg.MaxLifetime
+}
+
+// 借一条连接，用完后调用它的 Close 归还
+func (cp *ConnPool) Get(ctx context.Context) (*PooledConn, error) {
+	e, err := cp.pool.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &PooledConn{Conn: e.conn, pool: cp, entry: e}, nil
+}
+
+// 归还连接，等同于 conn.Close()
+func (cp *ConnPool) Put(conn *PooledConn) error {
+	return conn.Close()
+}
+
+// 关闭池子和所有空闲连接，借出的连接归还时关闭
+func (cp *ConnPool) Close() {
+	cp.pool.Close()
+}
+
+// 统计信息
+func (cp *ConnPool) Stats() Stats {
+	return cp.pool.Stats()
+}
+
+// 借出的连接
+type PooledConn struct {
+	net.Conn
+	pool   *ConnPool
+	entry  *connEntry
+	mu     sync.Mutex
+	closed bool
+	broken int32
+}
+
+// 标记连接已坏，Close 时真正关闭它而不是还给池子
+func (c *PooledConn) MarkBroken() {
+	atomic.StoreInt32(&c.broken, 1)
+}
+
+func (c *PooledConn) Read(b []byte) (int, error) {
+	if c.isClosed() {
+		return 0, net.ErrClosed
+	}
+	n, err := c.Conn.Read(b)
+	c.checkErr(err)
+	return n, err
+}
+
+func (c *PooledConn) Write(b []byte) (int, error) {
+	if c.isClosed() {
+		return 0, net.ErrClosed
+	}
+	n, err := c.Conn.Write(b)
+	c.checkErr(err)
+	return n, err
+}
+
+// 读写超时不影响连接继续使用，其他错误说明连接已经不可靠
+func (c *PooledConn) checkErr(err error) {
+	var ne net.Error
+	if err != nil && !(errors.As(err, &ne) && ne.Timeout()) {
+		c.MarkBroken()
+	}
+}
+
+func (c *PooledConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// 归还连接，已坏的连接被关闭，重复调用返回 net.ErrClosed
+func (c *PooledConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return net.ErrClosed
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	if atomic.LoadInt32(&c.broken) == 1 {
+		return c.pool.pool.Discard(c.entry)
+	}
+	// 清掉调用方设置的超时，下一个借到的人拿到的是干净的连接
+	if err := c.Conn.SetDeadline(time.Time{}); err != nil {
+		return c.pool.pool.Discard(c.entry)
+	}
+	return c.pool.pool.Put(c.entry)
+}
@@ -0,0 +1,227 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 用 net.Pipe 模拟的服务端：原样回显，记录建立过的连接
+type echoServer struct {
+	dials int64
+	peers chan net.Conn // 服务端一侧的连接，测试里可以主动关掉
+}
+
+func newEchoServer() *echoServer {
+	return &echoServer{peers: make(chan net.Conn, 16)}
+}
+
+func (s *echoServer) dial(ctx context.Context) (net.Conn, error) {
+	atomic.AddInt64(&s.dials, 1)
+	client, server := net.Pipe()
+	s.peers <- server
+	go func() {
+		_, _ = io.Copy(server, server)
+		server.Close()
+	}()
+	return client, nil
+}
+
+func (s *echoServer) dialCount() int64 {
+	return atomic.LoadInt64(&s.dials)
+}
+
+func roundTrip(t *testing.T, c net.Conn) {
+	t.Helper()
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo failed: %q %v", buf, err)
+	}
+}
+
+// TestConnPoolReuse 测试 Close 把连接还给池子，下次借出的是同一条连接
+func TestConnPoolReuse(t *testing.T) {
+	s := newEchoServer()
+	p, err := NewConnPool(ConnPoolConfig{Dial: s.dial, MaxSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	c, _ := p.Get(context.Background())
+	roundTrip(t, c)
+	raw := c.Conn
+	_ = c.SetReadDeadline(time.Now().Add(time.Hour))
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("second close should return net.ErrClosed, got %v", err)
+	}
+	if _, err := c.Write([]byte("x")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("stale handle should not write, got %v", err)
+	}
+
+	c2, _ := p.Get(context.Background())
+	defer c2.Close()
+	if c2.Conn != raw {
+		t.Error("returned connection should be reused")
+	}
+	roundTrip(t, c2)
+	if s.dialCount() != 1 {
+		t.Errorf("expected 1 dial, got %d", s.dialCount())
+	}
+}
+
+// TestConnPoolBroken 测试标记为坏的连接和读写出错的连接不会回到池子
+func TestConnPoolBroken(t *testing.T) {
+	s := newEchoServer()
+	p, _ := NewConnPool(ConnPoolConfig{Dial: s.dial})
+	defer p.Close()
+
+	c, _ := p.Get(context.Background())
+	c.MarkBroken()
+	_ = c.Close()
+	if _, err := c.Conn.Write([]byte("x")); err == nil {
+		t.Error("broken connection should be closed")
+	}
+
+	// 对端关闭连接，读到 EOF 后自动标记为坏
+	c, _ = p.Get(context.Background())
+	(<-s.peers).Close() // 第一条连接的服务端
+	(<-s.peers).Close()
+	if _, err := c.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read should fail after peer closed")
+	}
+	_ = c.Close()
+
+	if st := p.Stats(); st.Idle != 0 || st.Destroyed != 2 {
+		t.Errorf("broken connections should be destroyed, got %+v", st)
+	}
+	c, _ = p.Get(context.Background())
+	defer c.Close()
+	roundTrip(t, c)
+	if s.dialCount() != 3 {
+		t.Errorf("expected a fresh dial, got %d dials", s.dialCount())
+	}
+}
+
+// TestConnPoolTimeout 测试读写超时不会让连接被丢弃
+func TestConnPoolTimeout(t *testing.T) {
+	s := newEchoServer()
+	p, _ := NewConnPool(ConnPoolConfig{Dial: s.dial})
+	defer p.Close()
+
+	c, _ := p.Get(context.Background())
+	_ = c.SetReadDeadline(time.Now().Add(time.Millisecond))
+	if _, err := c.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read should time out")
+	}
+	_ = c.Close()
+	c, _ = p.Get(context.Background())
+	defer c.Close()
+	roundTrip(t, c)
+	if s.dialCount() != 1 {
+		t.Errorf("timed out connection should be reused, got %d dials", s.dialCount())
+	}
+}
+
+// TestConnPoolHealthCheck 测试借出前的健康检查
+func TestConnPoolHealthCheck(t *testing.T) {
+	s := newEchoServer()
+	var healthy int32 = 1
+	p, _ := NewConnPool(ConnPoolConfig{
+		Dial: s.dial,
+		HealthCheck: func(net.Conn) error {
+			if atomic.LoadInt32(&healthy) == 0 {
+				return errors.New("unhealthy")
+			}
+			return nil
+		},
+	})
+	defer p.Close()
+
+	c, _ := p.Get(context.Background())
+	_ = c.Close()
+	atomic.StoreInt32(&healthy, 0)
+	c, _ = p.Get(context.Background())
+	defer c.Close()
+	if s.dialCount() != 2 {
+		t.Errorf("unhealthy idle connection should be replaced, got %d dials", s.dialCount())
+	}
+}
+
+// TestConnPoolMaxLifetime 测试超过最大存活时间的连接归还时被关闭
+func TestConnPoolMaxLifetime(t *testing.T) {
+	s := newEchoServer()
+	p, _ := NewConnPool(ConnPoolConfig{Dial: s.dial, MaxLifetime: 10 * time.Millisecond})
+	defer p.Close()
+
+	c, _ := p.Get(context.Background())
+	time.Sleep(15 * time.Millisecond)
+	_ = c.Close()
+	if st := p.Stats(); st.Idle != 0 || st.Destroyed != 1 {
+		t.Errorf("expired connection should be closed on return, got %+v", st)
+	}
+
+	c, _ = p.Get(context.Background())
+	_ = c.Close()
+	time.Sleep(15 * time.Millisecond)
+	c, _ = p.Get(context.Background())
+	defer c.Close()
+	if s.dialCount() != 3 {
+		t.Errorf("expired idle connection should not be handed out, got %d dials", s.dialCount())
+	}
+}
+
+// TestConnPoolLoopback 测试真实的 TCP 连接
+func TestConnPoolLoopback(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	var d net.Dialer
+	p, _ := NewConnPool(ConnPoolConfig{
+		Dial: func(ctx context.Context) (net.Conn, error) {
+			return d.DialContext(ctx, "tcp", l.Addr().String())
+		},
+		MaxSize: 2,
+		MinIdle: 1,
+	})
+	defer p.Close()
+	if p.Stats().Idle != 1 {
+		t.Error("MinIdle connection should be dialed up front")
+	}
+	for i := 0; i < 3; i++ {
+		c, err := p.Get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		roundTrip(t, c)
+		_ = c.Close()
+	}
+	if st := p.Stats(); st.Created != 1 {
+		t.Errorf("expected a single connection, got %+v", st)
+	}
+}
@@ -0,0 +1,114 @@
+package pool
+
+import (
+	"log"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+/*
+统计与泄漏排查
+设计思想：
+
+	借出的对象没有归还，池子就悄悄地少了一个名额，少到 0 时所有 Get 都卡住，而且查不出是谁拿走的
+	1.每个借出的对象都记下借出时间，TrackStacks 打开时再记下调用栈
+	2.Borrowed 列出所有未归还的对象，最早借出的在前
+	3.AbandonTimeout 打开后，后台协程定期检查借出太久的对象，调用 OnAbandoned(默认写日志)，
+	  ReclaimAbandoned 时还会销毁它、腾出名额，持有者之后的 Put 会返回 ErrNotBorrowed
+	4.Stats 返回池子的使用情况，包括 Get 排队的次数和总时长，用来判断 MaxSize 是否够用
+	调用栈只在 TrackStacks 时记录，平时只多记一个时间
+*/
+
+// 池子的统计信息
+type Stats struct {
+	InUse        int           // 借出未归还的对象数
+	Idle         int           // 空闲对象数
+	Created      uint64        // 累计创建的对象数
+	Destroyed    uint64        // 累计销毁的对象数
+	WaitCount    uint64        // 需要排队的 Get 次数
+	WaitDuration time.Duration // Get 排队的总时长
+	Abandoned    uint64        // 发现的泄漏次数
+}
+
+// 一次借出的信息
+type BorrowInfo struct {
+	Since     time.Time
+	Stack     string // 只在 TrackStacks 时记录
+	abandoned bool
+}
+
+// 借出时的调用栈，TrackStacks 关闭时为空
+func (p *ObjectPool[T]) callerStack() string {
+	if !p.cfg.TrackStacks {
+		return ""
+	}
+	return string(debug.Stack())
+}
+
+// 调用方需持有 p.mu
+func (p *ObjectPool[T]) borrowLocked(obj T, stack string) bool {
+	if _, ok := p.borrowed[obj]; ok {
+		return false
+	}
+	p.borrowed[obj] = &BorrowInfo{Since: time.Now(), Stack: stack}
+	return true
+}
+
+// 检查借出超过 AbandonTimeout 的对象
+func (p *ObjectPool[T]) checkAbandoned(now time.Time) {
+	if p.cfg.AbandonTimeout <= 0 {
+		return
+	}
+	type leak struct {
+		obj  T
+		info BorrowInfo
+	}
+	var leaks []leak
+	p.mu.Lock()
+	for obj, info := range p.borrowed {
+		if info.abandoned || now.Sub(info.Since) < p.cfg.AbandonTimeout {
+			continue
+		}
+		info.abandoned = true
+		p.stats.Abandoned++
+		leaks = append(leaks, leak{obj: obj, info: *info})
+		if p.cfg.ReclaimAbandoned {
+			delete(p.borrowed, obj)
+			p.destroyLocked(obj)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, l := range leaks {
+		if p.cfg.OnAbandoned != nil {
+			p.cfg.OnAbandoned(l.obj, l.info)
+		} else {
+			log.Printf("pool: object borrowed at %s not returned after %v\n%s", l.info.Since.Format(time.RFC3339), p.cfg.AbandonTimeout, l.info.Stack)
+		}
+	}
+}
+
+// 所有未归还对象的借出信息，最早借出的在前
+func (p *ObjectPool[T]) Borrowed() []BorrowInfo {
+	p.mu.Lock()
+	infos := make([]BorrowInfo, 0, len(p.borrowed))
+	for _, info := range p.borrowed {
+		infos = append(infos, *info)
+	}
+	p.mu.Unlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Since.Before(infos[j].Since)
+	})
+	return infos
+}
+
+// 统计信息
+func (p *ObjectPool[T]) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := p.stats
+	st.InUse = len(p.borrowed)
+	st.Idle = len(p.idle)
+	return st
+}
@@ -0,0 +1,113 @@
+package pool
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStats 测试借还、创建销毁和排队的统计
+func TestStats(t *testing.T) {
+	cfg := (&factory{}).config()
+	cfg.MaxSize = 1
+	p, _ := NewObjectPool(cfg)
+	defer p.Close()
+
+	a, _ := p.Get(context.Background())
+	got := make(chan *Object, 1)
+	go func() {
+		obj, _ := p.Get(context.Background())
+		got <- obj
+	}()
+	waitFor(t, func() bool { return p.Stats().WaitCount == 1 })
+	time.Sleep(5 * time.Millisecond)
+	_ = p.Put(a)
+	b := <-got
+
+	st := p.Stats()
+	if st.InUse != 1 || st.Idle != 0 || st.Created != 1 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+	if st.WaitDuration < 5*time.Millisecond {
+		t.Errorf("wait duration should be recorded, got %v", st.WaitDuration)
+	}
+
+	_ = p.Discard(b)
+	if st := p.Stats(); st.InUse != 0 || st.Destroyed != 1 {
+		t.Errorf("unexpected stats after discard %+v", st)
+	}
+}
+
+// TestBorrowed 测试记录借出时间和调用栈
+func TestBorrowed(t *testing.T) {
+	cfg := (&factory{}).config()
+	cfg.TrackStacks = true
+	p, _ := NewObjectPool(cfg)
+	defer p.Close()
+
+	a, _ := p.Get(context.Background())
+	time.Sleep(time.Millisecond)
+	b, _ := p.Get(context.Background())
+	infos := p.Borrowed()
+	if len(infos) != 2 || !infos[0].Since.Before(infos[1].Since) {
+		t.Fatalf("expected 2 borrows oldest first, got %+v", infos)
+	}
+	if !strings.Contains(infos[0].Stack, "TestBorrowed") {
+		t.Errorf("stack should point at the caller:\n%s", infos[0].Stack)
+	}
+	_ = p.Put(a)
+	_ = p.Put(b)
+	if len(p.Borrowed()) != 0 {
+		t.Error("returned objects should not be listed")
+	}
+}
+
+// TestAbandoned 测试泄漏的对象被报告一次，并在 ReclaimAbandoned 时被回收
+func TestAbandoned(t *testing.T) {
+	for _, reclaim := range []bool{false, true} {
+		f := &factory{}
+		cfg := f.config()
+		cfg.MaxSize = 1
+		cfg.AbandonTimeout = 10 * time.Millisecond
+		cfg.ReapInterval = 2 * time.Millisecond
+		cfg.ReclaimAbandoned = reclaim
+
+		var (
+			mu      sync.Mutex
+			reports int
+		)
+		cfg.OnAbandoned = func(*Object, BorrowInfo) {
+			mu.Lock()
+			reports++
+			mu.Unlock()
+		}
+		p, _ := NewObjectPool(cfg)
+
+		leaked, _ := p.Get(context.Background())
+		waitFor(t, func() bool { return p.Stats().Abandoned == 1 })
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		if reports != 1 {
+			t.Errorf("reclaim=%v: expected 1 report, got %d", reclaim, reports)
+		}
+		mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		obj, err := p.Get(ctx)
+		cancel()
+		if reclaim {
+			if err != nil {
+				t.Errorf("reclaimed slot should be available: %v", err)
+			}
+			if err := p.Put(leaked); err != ErrNotBorrowed {
+				t.Errorf("late put of a reclaimed object should fail, got %v", err)
+			}
+			_ = p.Put(obj)
+		} else if err != context.DeadlineExceeded {
+			t.Errorf("leaked object should still hold the slot, got %v", err)
+		}
+		p.Close()
+	}
+}
@@ -11,6 +11,7 @@ import "fmt"
 	1.对象结构体
 	2.类型为结构体指针的channel
 	3.New方法, 创建新的对象放到channel中
+	NewPool 只能取不能还，可以借还、按需创建的池子见 objectpool.go
 */
 type Object struct {
 	Name string
@@ -0,0 +1,368 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+/*
+有界对象池
+设计思想：
+
+	NewPool 预先创建好对象放进 chan 后立即关闭，对象被取完之后池子就永远空了，归还时还会向已关闭的 chan 写入而 panic
+	ObjectPool 是一个真正可以借还的池子：
+	1.Get 优先取空闲对象，没有空闲且总数未到 MaxSize 时用 New 现场创建，否则排队等待别人归还，直到 ctx 结束
+	2.Put 归还对象，Discard 销毁一个坏掉的对象，腾出的名额交给排队的 Get
+	3.MinIdle 个对象在创建池子时预热，之后由后台协程维持
+	4.OnBorrow/OnReturn 在借出、归还时检查对象，不合格的直接销毁
+	5.空闲超过 IdleTimeout 的对象由后台协程回收，但空闲数不会低于 MinIdle
+	6.Close 销毁所有空闲对象，之后归还的对象也直接销毁
+	7.借出的对象会被记录下来，用于统计和泄漏排查(见 leak.go)
+	借出的对象以自身为键记录，所以每个对象必须各不相同，T 通常是指针。
+	值类型(例如 int)的 New 返回了一个正在借出的值时，这个重复的对象会被销毁，Get 返回 ErrDuplicateObject
+	空闲对象后进先出：最近用过的对象最"热"，不常用的留在栈底，正好被空闲回收
+	New、Destroy 和检查函数都在锁外调用，可以做网络请求这样的慢操作
+*/
+var (
+	ErrPoolClosed  = errors.New("pool: pool closed")
+	ErrNoFactory   = errors.New("pool: Config.New is required")
+	ErrNotBorrowed = errors.New("pool: object was not borrowed from this pool")
+	// New 返回的对象和一个借出的对象相等，T 应该是指针这类每个对象各不相同的类型
+	ErrDuplicateObject = errors.New("pool: object is already borrowed")
+)
+
+// 池子的通用接口
+type Interface[T any] interface {
+	Get(ctx context.Context) (T, error)
+	Put(obj T) error
+	Close()
+}
+
+// 池子的配置，只有 New 是必填的
+type Config[T any] struct {
+	New          func(ctx context.Context) (T, error) // 创建对象
+	Destroy      func(obj T)                          // 销毁对象，可以为空
+	OnBorrow     func(obj T) bool                     // 借出空闲对象前检查，返回 false 时销毁并换一个
+	OnReturn     func(obj T) bool                     // 归还时检查，返回 false 时销毁
+	MaxSize      int                                  // 借出和空闲的对象总数上限，不大于0时不限制
+	MinIdle      int                                  // 至少保持的空闲对象数
+	IdleTimeout  time.Duration                        // 空闲超过这个时间的对象被回收，不大于0时不回收
+	ReapInterval time.Duration                        // 后台协程的检查间隔，默认 IdleTimeout 和 AbandonTimeout 中较小的一半，都没有时 1s
+
+	// 泄漏排查(见 leak.go)
+	TrackStacks      bool                         // 借出时记录调用栈
+	AbandonTimeout   time.Duration                // 借出超过这个时间算作泄漏，不大于0时不检查
+	ReclaimAbandoned bool                         // 回收泄漏的对象：销毁并腾出名额，之后的 Put 返回 ErrNotBorrowed
+	OnAbandoned      func(obj T, info BorrowInfo) // 发现泄漏时调用，每次借出最多一次，为空时写日志
+}
+
+type idleObject[T any] struct {
+	obj   T
+	since time.Time
+}
+
+type ObjectPool[T comparable] struct {
+	cfg Config[T]
+
+	mu       sync.Mutex
+	idle     []idleObject[T] // 栈顶是最近归还的
+	borrowed map[T]*BorrowInfo
+	open     int             // 借出、空闲和正在创建的对象总数
+	waiters  []chan struct{} // 排队的 Get，有名额时唤醒一个
+	closed   bool
+	stats    Stats // InUse 和 Idle 在读取时计算
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+var _ Interface[*Object] = (*ObjectPool[*Object])(nil)
+
+// 创建池子并预热 MinIdle 个对象，预热失败时返回错误
+func NewObjectPool[T comparable](cfg Config[T]) (*ObjectPool[T], error) {
+	if cfg.New == nil {
+		return nil, ErrNoFactory
+	}
+	if cfg.MaxSize > 0 && cfg.MinIdle > cfg.MaxSize {
+		cfg.MinIdle = cfg.MaxSize
+	}
+	if cfg.ReapInterval <= 0 {
+		cfg.ReapInterval = cfg.IdleTimeout / 2
+		if cfg.AbandonTimeout > 0 && (cfg.ReapInterval <= 0 || cfg.AbandonTimeout/2 < cfg.ReapInterval) {
+			cfg.ReapInterval = cfg.AbandonTimeout / 2
+		}
+		if cfg.ReapInterval <= 0 {
+			cfg.ReapInterval = time.Second
+		}
+	}
+	p := &ObjectPool[T]{
+		cfg:      cfg,
+		borrowed: make(map[T]*BorrowInfo),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err := p.fill(context.Background()); err != nil {
+		close(p.done)
+		p.Close()
+		return nil, err
+	}
+	if cfg.IdleTimeout > 0 || cfg.MinIdle > 0 || cfg.AbandonTimeout > 0 {
+		go p.reap()
+	} else {
+		close(p.done)
+	}
+	return p, nil
+}
+
+// 借一个对象，没有可用对象时等待直到 ctx 结束
+func (p *ObjectPool[T]) Get(ctx context.Context) (T, error) {
+	var (
+		zero   T
+		stack  = p.callerStack()
+		waited bool
+	)
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return zero, ErrPoolClosed
+		}
+		if n := len(p.idle); n > 0 {
+			obj := p.idle[n-1].obj
+			p.idle[n-1] = idleObject[T]{}
+			p.idle = p.idle[:n-1]
+			if !p.borrowLocked(obj, stack) {
+				// 空闲栈里混进了和借出对象相等的值，不能再借出一次
+				p.destroyLocked(obj)
+				continue
+			}
+			p.mu.Unlock()
+			if p.cfg.OnBorrow == nil || p.cfg.OnBorrow(obj) {
+				return obj, nil
+			}
+			p.mu.Lock()
+			if _, ok := p.borrowed[obj]; ok {
+				delete(p.borrowed, obj)
+				p.destroyLocked(obj)
+			}
+			continue
+		}
+		if p.cfg.MaxSize <= 0 || p.open < p.cfg.MaxSize {
+			p.open++
+			p.mu.Unlock()
+			obj, err := p.cfg.New(ctx)
+			p.mu.Lock()
+			if err != nil {
+				p.open--
+				p.notifyLocked()
+				p.mu.Unlock()
+				return zero, err
+			}
+			p.stats.Created++
+			if !p.borrowLocked(obj, stack) {
+				p.destroyLocked(obj)
+				p.mu.Unlock()
+				return zero, ErrDuplicateObject
+			}
+			p.mu.Unlock()
+			return obj, nil
+		}
+
+		if !waited {
+			waited = true
+			p.stats.WaitCount++
+		}
+		start := time.Now()
+		w := make(chan struct{}, 1)
+		p.waiters = append(p.waiters, w)
+		p.mu.Unlock()
+		select {
+		case <-w:
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.stats.WaitDuration += time.Since(start)
+			if !p.removeWaiterLocked(w) {
+				// 已经被唤醒，把名额让给下一个
+				p.notifyLocked()
+			}
+			p.mu.Unlock()
+			return zero, ctx.Err()
+		}
+		p.mu.Lock()
+		p.stats.WaitDuration += time.Since(start)
+	}
+}
+
+// 归还对象，OnReturn 检查不通过或池子已关闭时销毁
+func (p *ObjectPool[T]) Put(obj T) error {
+	p.mu.Lock()
+	if _, ok := p.borrowed[obj]; !ok {
+		p.mu.Unlock()
+		return ErrNotBorrowed
+	}
+	delete(p.borrowed, obj)
+	closed := p.closed
+	p.mu.Unlock()
+
+	if !closed && (p.cfg.OnReturn == nil || p.cfg.OnReturn(obj)) {
+		p.mu.Lock()
+		if !p.closed {
+			p.idle = append(p.idle, idleObject[T]{obj: obj, since: time.Now()})
+			p.notifyLocked()
+			p.mu.Unlock()
+			return nil
+		}
+		p.mu.Unlock()
+	}
+	p.mu.Lock()
+	p.destroyLocked(obj)
+	p.mu.Unlock()
+	return nil
+}
+
+// 销毁一个借出的对象，例如发现它已经坏了
+func (p *ObjectPool[T]) Discard(obj T) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.borrowed[obj]; !ok {
+		return ErrNotBorrowed
+	}
+	delete(p.borrowed, obj)
+	p.destroyLocked(obj)
+	return nil
+}
+
+// 销毁对象并腾出名额，Destroy 在锁外调用，调用方需持有 p.mu
+func (p *ObjectPool[T]) destroyLocked(obj T) {
+	p.open--
+	p.stats.Destroyed++
+	p.notifyLocked()
+	if p.cfg.Destroy != nil {
+		p.mu.Unlock()
+		p.cfg.Destroy(obj)
+		p.mu.Lock()
+	}
+}
+
+// 唤醒一个排队的 Get，调用方需持有 p.mu
+func (p *ObjectPool[T]) notifyLocked() {
+	if len(p.waiters) > 0 {
+		w := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		w <- struct{}{}
+	}
+}
+
+// 调用方需持有 p.mu
+func (p *ObjectPool[T]) removeWaiterLocked(w chan struct{}) bool {
+	for i, q := range p.waiters {
+		if q == w {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// 补足 MinIdle 个空闲对象
+func (p *ObjectPool[T]) fill(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		if p.closed || len(p.idle) >= p.cfg.MinIdle || (p.cfg.MaxSize > 0 && p.open >= p.cfg.MaxSize) {
+			p.mu.Unlock()
+			return nil
+		}
+		p.open++
+		p.mu.Unlock()
+
+		obj, err := p.cfg.New(ctx)
+		p.mu.Lock()
+		if err != nil {
+			p.open--
+			p.notifyLocked()
+			p.mu.Unlock()
+			return err
+		}
+		p.stats.Created++
+		if p.closed {
+			p.destroyLocked(obj)
+			p.mu.Unlock()
+			return nil
+		}
+		p.idle = append(p.idle, idleObject[T]{obj: obj, since: time.Now()})
+		p.notifyLocked()
+		p.mu.Unlock()
+	}
+}
+
+// 后台协程：回收空闲太久的对象，补足 MinIdle
+func (p *ObjectPool[T]) reap() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.cfg.ReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.quit:
+			return
+		}
+		p.evictIdle(time.Now())
+		p.checkAbandoned(time.Now())
+		_ = p.fill(context.Background())
+	}
+}
+
+// 回收空闲超过 IdleTimeout 的对象，保留 MinIdle 个
+func (p *ObjectPool[T]) evictIdle(now time.Time) {
+	if p.cfg.IdleTimeout <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 栈底的对象空闲得最久
+	for len(p.idle) > p.cfg.MinIdle && now.Sub(p.idle[0].since) >= p.cfg.IdleTimeout {
+		obj := p.idle[0].obj
+		p.idle[0] = idleObject[T]{}
+		p.idle = p.idle[1:]
+		p.destroyLocked(obj)
+	}
+}
+
+// 关闭池子，销毁所有空闲对象，排队的 Get 返回 ErrPoolClosed，可以重复调用
+func (p *ObjectPool[T]) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		<-p.done
+		return
+	}
+	p.closed = true
+	close(p.quit)
+	idle := p.idle
+	p.idle = nil
+	for _, w := range p.waiters {
+		w <- struct{}{}
+	}
+	p.waiters = nil
+	for _, o := range idle {
+		p.destroyLocked(o.obj)
+	}
+	p.mu.Unlock()
+	<-p.done
+}
+
+// 空闲对象数
+func (p *ObjectPool[T]) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+// 借出、空闲和正在创建的对象总数
+func (p *ObjectPool[T]) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.open
+}
@@ -0,0 +1,298 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 记录创建和销毁次数的对象工厂
+type factory struct {
+	created   int64
+	destroyed int64
+}
+
+func (f *factory) config() Config[*Object] {
+	return Config[*Object]{
+		New: func(ctx context.Context) (*Object, error) {
+			atomic.AddInt64(&f.created, 1)
+			return &Object{}, nil
+		},
+		Destroy: func(*Object) {
+			atomic.AddInt64(&f.destroyed, 1)
+		},
+	}
+}
+
+func (f *factory) counts() (int64, int64) {
+	return atomic.LoadInt64(&f.created), atomic.LoadInt64(&f.destroyed)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestObjectPoolReuse 测试归还的对象被再次借出，不会重复创建
+func TestObjectPoolReuse(t *testing.T) {
+	f := &factory{}
+	p, err := NewObjectPool(f.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	a, _ := p.Get(context.Background())
+	if err := p.Put(a); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := p.Get(context.Background())
+	if a != b {
+		t.Error("idle object should be reused")
+	}
+	if created, _ := f.counts(); created != 1 {
+		t.Errorf("expected 1 object created, got %d", created)
+	}
+	if err := p.Put(&Object{}); err != ErrNotBorrowed {
+		t.Errorf("expected ErrNotBorrowed, got %v", err)
+	}
+	if err := p.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Put(b); err != ErrNotBorrowed {
+		t.Errorf("double put should fail, got %v", err)
+	}
+}
+
+// TestObjectPoolMaxSize 测试对象数到上限后 Get 排队，归还后被唤醒
+func TestObjectPoolMaxSize(t *testing.T) {
+	cfg := (&factory{}).config()
+	cfg.MaxSize = 2
+	p, _ := NewObjectPool(cfg)
+	defer p.Close()
+
+	a, _ := p.Get(context.Background())
+	_, _ = p.Get(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+
+	got := make(chan *Object, 1)
+	go func() {
+		obj, _ := p.Get(context.Background())
+		got <- obj
+	}()
+	time.Sleep(5 * time.Millisecond)
+	_ = p.Put(a)
+	select {
+	case obj := <-got:
+		if obj != a {
+			t.Error("waiter should receive the returned object")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter should be woken by Put")
+	}
+	if p.Size() != 2 {
+		t.Errorf("expected 2 objects, got %d", p.Size())
+	}
+}
+
+// TestObjectPoolConcurrent 测试并发借还时对象数不超过上限
+func TestObjectPoolConcurrent(t *testing.T) {
+	f := &factory{}
+	cfg := f.config()
+	cfg.MaxSize = 3
+	p, _ := NewObjectPool(cfg)
+
+	var (
+		wg     sync.WaitGroup
+		active int64
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			obj, err := p.Get(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if n := atomic.AddInt64(&active, 1); n > 3 {
+				t.Errorf("%d objects borrowed at once", n)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt64(&active, -1)
+			_ = p.Put(obj)
+		}()
+	}
+	wg.Wait()
+	p.Close()
+	created, destroyed := f.counts()
+	if created > 3 || created != destroyed {
+		t.Errorf("created %d, destroyed %d", created, destroyed)
+	}
+}
+
+// TestObjectPoolValidate 测试借出和归还时的检查
+func TestObjectPoolValidate(t *testing.T) {
+	f := &factory{}
+	cfg := f.config()
+	cfg.OnReturn = func(o *Object) bool { return o.Name != "broken" }
+	cfg.OnBorrow = func(o *Object) bool { return o.Name != "stale" }
+	p, _ := NewObjectPool(cfg)
+	defer p.Close()
+
+	a, _ := p.Get(context.Background())
+	a.Name = "broken"
+	_ = p.Put(a)
+	if p.Idle() != 0 || p.Size() != 0 {
+		t.Error("object failing OnReturn should be destroyed")
+	}
+
+	b, _ := p.Get(context.Background())
+	_ = p.Put(b)
+	b.Name = "stale"
+	c, _ := p.Get(context.Background())
+	if c == b {
+		t.Error("object failing OnBorrow should not be handed out")
+	}
+	if _, destroyed := f.counts(); destroyed != 2 {
+		t.Errorf("expected 2 destroyed, got %d", destroyed)
+	}
+
+	if err := p.Discard(c); err != nil {
+		t.Fatal(err)
+	}
+	if p.Size() != 0 {
+		t.Errorf("discarded object should free its slot, size %d", p.Size())
+	}
+}
+
+// TestObjectPoolIdle 测试预热、空闲回收和 MinIdle 的维持
+func TestObjectPoolIdle(t *testing.T) {
+	f := &factory{}
+	cfg := f.config()
+	cfg.MinIdle = 2
+	cfg.IdleTimeout = 20 * time.Millisecond
+	cfg.ReapInterval = 5 * time.Millisecond
+	p, _ := NewObjectPool(cfg)
+	defer p.Close()
+	if p.Idle() != 2 {
+		t.Fatalf("expected 2 warm objects, got %d", p.Idle())
+	}
+
+	var objs []*Object
+	for i := 0; i < 5; i++ {
+		obj, _ := p.Get(context.Background())
+		objs = append(objs, obj)
+	}
+	for _, obj := range objs {
+		_ = p.Put(obj)
+	}
+	waitFor(t, func() bool { return p.Size() == 2 })
+	if p.Idle() != 2 {
+		t.Errorf("idle objects beyond MinIdle should be reaped, got %d", p.Idle())
+	}
+
+	a, _ := p.Get(context.Background())
+	b, _ := p.Get(context.Background())
+	waitFor(t, func() bool { return p.Idle() == 2 })
+	_ = p.Put(a)
+	_ = p.Put(b)
+}
+
+// TestObjectPoolClose 测试关闭后销毁空闲对象，排队的 Get 返回 ErrPoolClosed
+func TestObjectPoolClose(t *testing.T) {
+	f := &factory{}
+	cfg := f.config()
+	cfg.MaxSize = 1
+	p, _ := NewObjectPool(cfg)
+
+	a, _ := p.Get(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := p.Get(context.Background())
+		errs <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	p.Close()
+	if err := <-errs; err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed, got %v", err)
+	}
+	_ = p.Put(a)
+	if _, destroyed := f.counts(); destroyed != 1 {
+		t.Error("object returned after Close should be destroyed")
+	}
+	if _, err := p.Get(context.Background()); err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed, got %v", err)
+	}
+	p.Close()
+}
+
+// TestObjectPoolFactoryError 测试创建失败时返回错误并腾出名额
+func TestObjectPoolFactoryError(t *testing.T) {
+	errDial := errors.New("dial failed")
+	fail := true
+	p, _ := NewObjectPool(Config[*Object]{
+		MaxSize: 1,
+		New: func(ctx context.Context) (*Object, error) {
+			if fail {
+				return nil, errDial
+			}
+			return &Object{}, nil
+		},
+	})
+	defer p.Close()
+	if _, err := p.Get(context.Background()); err != errDial {
+		t.Fatalf("expected factory error, got %v", err)
+	}
+	fail = false
+	if _, err := p.Get(context.Background()); err != nil {
+		t.Errorf("failed creation should not hold a slot: %v", err)
+	}
+
+	if _, err := NewObjectPool(Config[*Object]{}); err != ErrNoFactory {
+		t.Errorf("expected ErrNoFactory, got %v", err)
+	}
+}
+
+// TestObjectPoolDuplicateValue 测试值类型的工厂返回重复的值时不会丢失名额
+func TestObjectPoolDuplicateValue(t *testing.T) {
+	p, err := NewObjectPool(Config[int]{
+		New:     func(ctx context.Context) (int, error) { return 0, nil },
+		MaxSize: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	a, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Get(context.Background()); !errors.Is(err, ErrDuplicateObject) {
+		t.Fatalf("Get duplicate = %v, want ErrDuplicateObject", err)
+	}
+	if n := p.Size(); n != 1 {
+		t.Errorf("duplicate object should be destroyed, Size = %d", n)
+	}
+	if err := p.Put(a); err != nil {
+		t.Fatalf("Put = %v", err)
+	}
+	if n := p.Stats().InUse; n != 0 {
+		t.Errorf("InUse = %d, want 0", n)
+	}
+}
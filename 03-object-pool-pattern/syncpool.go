@@ -0,0 +1,69 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+基于 sync.Pool 的对象池
+设计思想：
+
+	与 ObjectPool 实现同一个 Interface，配置也用同一个 Config，两种策略可以直接互换，用基准测试(benchmark_test.go)比较
+	sync.Pool 是一个缓存而不是池子：
+	1.没有上限、不会排队，Get 拿不到就立即创建
+	2.空闲对象会在 GC 时被悄悄丢掉，不会调用 Destroy，也不能用 MinIdle、IdleTimeout 控制
+	3.每个 P 有自己的本地缓存，并发 Get/Put 几乎没有锁竞争
+	所以它适合只是为了减少内存分配、丢了也无所谓的对象(缓冲区、编码器)；
+	创建成本高、需要限制总数或者需要显式关闭的对象(连接、文件句柄)用 ObjectPool
+	只使用 Config 中的 New、OnBorrow、OnReturn，其他字段被忽略
+*/
+type SyncPool[T any] struct {
+	cfg    Config[T]
+	pool   sync.Pool
+	closed int32
+}
+
+var _ Interface[*Object] = (*SyncPool[*Object])(nil)
+
+func NewSyncPool[T any](cfg Config[T]) (*SyncPool[T], error) {
+	if cfg.New == nil {
+		return nil, ErrNoFactory
+	}
+	return &SyncPool[T]{cfg: cfg}, nil
+}
+
+// 取一个对象，缓存为空时用 New 创建
+func (p *SyncPool[T]) Get(ctx context.Context) (T, error) {
+	var zero T
+	if atomic.LoadInt32(&p.closed) == 1 {
+		return zero, ErrPoolClosed
+	}
+	for {
+		v := p.pool.Get()
+		if v == nil {
+			return p.cfg.New(ctx)
+		}
+		obj := v.(T)
+		if p.cfg.OnBorrow == nil || p.cfg.OnBorrow(obj) {
+			return obj, nil
+		}
+	}
+}
+
+// 放回缓存，OnReturn 检查不通过或池子已关闭时丢弃
+func (p *SyncPool[T]) Put(obj T) error {
+	if atomic.LoadInt32(&p.closed) == 1 {
+		return nil
+	}
+	if p.cfg.OnReturn == nil || p.cfg.OnReturn(obj) {
+		p.pool.Put(obj)
+	}
+	return nil
+}
+
+// 关闭后 Get 返回 ErrPoolClosed，缓存中的对象交给 GC
+func (p *SyncPool[T]) Close() {
+	atomic.StoreInt32(&p.closed, 1)
+}
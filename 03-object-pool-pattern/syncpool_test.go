@@ -0,0 +1,41 @@
+package pool
+
+import (
+	"context"
+	"testing"
+)
+
+// TestSyncPool 测试 sync.Pool 版本的借还与关闭
+func TestSyncPool(t *testing.T) {
+	f := &factory{}
+	cfg := f.config()
+	cfg.OnReturn = func(o *Object) bool { return o.Name != "broken" }
+	var p Interface[*Object]
+	p, err := NewSyncPool(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := p.Get(context.Background())
+	if err != nil || a == nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	a.Name = "broken"
+	_ = p.Put(a)
+	b, _ := p.Get(context.Background())
+	if b == a {
+		t.Error("object failing OnReturn should be dropped")
+	}
+
+	p.Close()
+	if _, err := p.Get(context.Background()); err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed, got %v", err)
+	}
+	if err := p.Put(b); err != nil {
+		t.Errorf("put after close should drop silently, got %v", err)
+	}
+
+	if _, err := NewSyncPool(Config[*Object]{}); err != ErrNoFactory {
+		t.Errorf("expected ErrNoFactory, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package singleton
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+/*
+可重试、可重置的延迟初始化
+设计思想：
+
+	Lazy 保存一个延迟初始化的值，第一次 Get 时调用 init
+	1.初始化成功后值被缓存，之后的 Get 只有一次原子读，不加锁
+	2.初始化失败时不缓存，返回错误，下一次 Get 会重新初始化(sync.Once 失败了就永远失败了)
+	3.同一时间只有一个协程在初始化，其他协程等它的结果
+	4.Reset 清掉缓存的值，下一次 Get 重新初始化，主要给测试用
+	值装在一个指针里整体替换，Reset 和 Get 并发调用也是安全的
+*/
+type Lazy[T any] struct {
+	init func() (T, error)
+	mu   sync.Mutex   // 初始化时持有
+	v    atomic.Value // *lazyValue[T]
+}
+
+type lazyValue[T any] struct {
+	value T
+	ok    bool
+}
+
+func NewLazy[T any](init func() (T, error)) *Lazy[T] {
+	l := &Lazy[T]{init: init}
+	l.v.Store(&lazyValue[T]{})
+	return l
+}
+
+// 获取值，尚未初始化时调用 init，失败时返回错误，下次再试
+func (l *Lazy[T]) Get() (T, error) {
+	if v := l.v.Load().(*lazyValue[T]); v.ok {
+		return v.value, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// 等锁期间可能已经被别的协程初始化了
+	if v := l.v.Load().(*lazyValue[T]); v.ok {
+		return v.value, nil
+	}
+	value, err := l.init()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	l.v.Store(&lazyValue[T]{value: value, ok: true})
+	return value, nil
+}
+
+// 是否已经初始化成功
+func (l *Lazy[T]) Initialized() bool {
+	return l.v.Load().(*lazyValue[T]).ok
+}
+
+// 清掉缓存的值，下一次 Get 重新初始化
+func (l *Lazy[T]) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.v.Store(&lazyValue[T]{})
+}
@@ -0,0 +1,91 @@
+package singleton
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestLazyRetry 测试初始化失败后可以重试，成功后不再初始化
+func TestLazyRetry(t *testing.T) {
+	errDown := errors.New("database down")
+	calls := 0
+	l := NewLazy(func() (string, error) {
+		calls++
+		if calls == 1 {
+			return "", errDown
+		}
+		return "conn", nil
+	})
+
+	if _, err := l.Get(); err != errDown {
+		t.Fatalf("expected errDown, got %v", err)
+	}
+	if l.Initialized() {
+		t.Error("failed init should not be cached")
+	}
+	for i := 0; i < 3; i++ {
+		if v, err := l.Get(); err != nil || v != "conn" {
+			t.Fatalf("expected conn, got %q %v", v, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 init calls, got %d", calls)
+	}
+}
+
+// TestLazyConcurrent 测试并发 Get 只初始化一次
+func TestLazyConcurrent(t *testing.T) {
+	var calls int32
+	l := NewLazy(func() (*int, error) {
+		atomic.AddInt32(&calls, 1)
+		return new(int), nil
+	})
+
+	var (
+		wg   sync.WaitGroup
+		seen sync.Map
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _ := l.Get()
+			seen.Store(v, true)
+		}()
+	}
+	wg.Wait()
+	n := 0
+	seen.Range(func(_, _ interface{}) bool { n++; return true })
+	if calls != 1 || n != 1 {
+		t.Errorf("expected a single instance, got %d inits and %d instances", calls, n)
+	}
+}
+
+// TestLazyReset 测试重置后重新初始化
+func TestLazyReset(t *testing.T) {
+	n := 0
+	l := NewLazy(func() (int, error) {
+		n++
+		return n, nil
+	})
+	first, _ := l.Get()
+	l.Reset()
+	if l.Initialized() {
+		t.Error("reset should clear the value")
+	}
+	if second, _ := l.Get(); second == first {
+		t.Error("reset should trigger a fresh init")
+	}
+}
+
+// TestResetForTesting 测试 New 的实例可以在测试之间清掉
+func TestResetForTesting(t *testing.T) {
+	t.Cleanup(ResetForTesting)
+	New()["name"] = "lee"
+	ResetForTesting()
+	if _, ok := New()["name"]; ok {
+		t.Error("state should not leak after ResetForTesting")
+	}
+}
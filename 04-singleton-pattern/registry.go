@@ -0,0 +1,102 @@
+package singleton
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/*
+具名单例注册表
+设计思想：
+
+	每个单例都写一个全局变量加一个 Lazy，散落在各处，测试时也不知道要重置哪些
+	Registry 按名字登记单例的初始化函数，用的时候按名字取，第一次取时才初始化
+	1.Register 登记，名字重复时返回 ErrAlreadyRegistered
+	2.Lookup 按名字和类型取值，名字不存在返回 ErrNotRegistered，类型不对返回 ErrWrongType
+	3.Reset 把所有单例恢复到未初始化的状态，登记本身保留(登记通常在 init 中完成)
+	4.ResetForTesting 重置 New 的实例和 DefaultRegistry，在测试里 t.Cleanup(singleton.ResetForTesting) 即可
+	Go 的方法不能带类型参数，所以 Register、Lookup 是以 *Registry 为参数的函数
+*/
+var (
+	ErrAlreadyRegistered = errors.New("singleton: already registered")
+	ErrNotRegistered     = errors.New("singleton: not registered")
+	ErrWrongType         = errors.New("singleton: wrong type")
+)
+
+// 默认的注册表
+var DefaultRegistry = NewRegistry()
+
+type resetter interface {
+	Reset()
+}
+
+type Registry struct {
+	mu      sync.Mutex
+	entries map[string]resetter // *Lazy[T]
+}
+
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[string]resetter)}
+}
+
+// 登记一个单例，返回它的 Lazy，也可以直接保存下来使用
+func Register[T any](r *Registry, name string, init func() (T, error)) (*Lazy[T], error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.entries[name]; ok {
+		return nil, fmt.Errorf("%w: %q", ErrAlreadyRegistered, name)
+	}
+	l := NewLazy(init)
+	r.entries[name] = l
+	return l, nil
+}
+
+// 按名字取值，第一次取时初始化
+func Lookup[T any](r *Registry, name string) (T, error) {
+	var zero T
+	r.mu.Lock()
+	e, ok := r.entries[name]
+	r.mu.Unlock()
+	if !ok {
+		return zero, fmt.Errorf("%w: %q", ErrNotRegistered, name)
+	}
+	l, ok := e.(*Lazy[T])
+	if !ok {
+		return zero, fmt.Errorf("%w: %q is %T, not %T", ErrWrongType, name, e, l)
+	}
+	return l.Get()
+}
+
+// 所有登记过的名字，按字母排序
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.entries))
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 所有单例恢复到未初始化的状态
+// Lazy.Reset 会等正在进行的初始化结束，而初始化里可能会 Lookup 别的单例，所以不能持有 r.mu 调用
+func (r *Registry) Reset() {
+	r.mu.Lock()
+	entries := make([]resetter, 0, len(r.entries))
+	for _, e := range r.entries {
+		entries = append(entries, e)
+	}
+	r.mu.Unlock()
+	for _, e := range entries {
+		e.Reset()
+	}
+}
+
+// 重置 New 返回的实例和 DefaultRegistry 中的所有单例，只在测试中使用
+func ResetForTesting() {
+	instance.Reset()
+	DefaultRegistry.Reset()
+}
@@ -0,0 +1,112 @@
+package singleton
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type config struct {
+	DSN string
+}
+
+// TestRegistry 测试按名字登记和取值
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	inits := 0
+	if _, err := Register(r, "config", func() (*config, error) {
+		inits++
+		return &config{DSN: "mysql://"}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Register(r, "config", func() (*config, error) { return nil, nil }); !errors.Is(err, ErrAlreadyRegistered) {
+		t.Errorf("expected ErrAlreadyRegistered, got %v", err)
+	}
+	_, _ = Register(r, "name", func() (string, error) { return "app", nil })
+
+	a, err := Lookup[*config](r, "config")
+	if err != nil || a.DSN != "mysql://" {
+		t.Fatalf("unexpected lookup %+v %v", a, err)
+	}
+	b, _ := Lookup[*config](r, "config")
+	if a != b || inits != 1 {
+		t.Errorf("lookup should return the same instance, %d inits", inits)
+	}
+
+	if _, err := Lookup[*config](r, "missing"); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("expected ErrNotRegistered, got %v", err)
+	}
+	if _, err := Lookup[int](r, "name"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("expected ErrWrongType, got %v", err)
+	}
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"config", "name"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+
+	r.Reset()
+	c, _ := Lookup[*config](r, "config")
+	if c == a || inits != 2 {
+		t.Error("reset should re-initialize singletons on next lookup")
+	}
+}
+
+// TestDefaultRegistryReset 测试 ResetForTesting 重置默认注册表，登记本身保留
+func TestDefaultRegistryReset(t *testing.T) {
+	t.Cleanup(ResetForTesting)
+	// 用 -count 重复运行时已经登记过了
+	_, err := Register(DefaultRegistry, "test.counter", func() (*int, error) { return new(int), nil })
+	if err != nil && !errors.Is(err, ErrAlreadyRegistered) {
+		t.Fatal(err)
+	}
+	v, _ := Lookup[*int](DefaultRegistry, "test.counter")
+	*v = 42
+
+	ResetForTesting()
+	v, err = Lookup[*int](DefaultRegistry, "test.counter")
+	if err != nil || *v != 0 {
+		t.Errorf("expected a fresh counter, got %v %v", *v, err)
+	}
+}
+
+// TestRegistryResetDuringInit 测试初始化过程中 Lookup 别的单例时 Reset 不会死锁
+func TestRegistryResetDuringInit(t *testing.T) {
+	r := NewRegistry()
+	_, _ = Register(r, "dsn", func() (string, error) { return "mysql://", nil })
+	started, release := make(chan struct{}), make(chan struct{})
+	_, _ = Register(r, "config", func() (*config, error) {
+		close(started)
+		<-release
+		dsn, err := Lookup[string](r, "dsn")
+		return &config{DSN: dsn}, err
+	})
+
+	got := make(chan error, 1)
+	go func() {
+		_, err := Lookup[*config](r, "config")
+		got <- err
+	}()
+	<-started
+	reset := make(chan struct{})
+	go func() {
+		r.Reset()
+		close(reset)
+	}()
+	time.Sleep(10 * time.Millisecond) // 让 Reset 先等在初始化上
+	close(release)
+
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Lookup inside init deadlocked with Reset")
+	}
+	select {
+	case <-reset:
+	case <-time.After(time.Second):
+		t.Fatal("Reset did not return")
+	}
+}
@@ -1,26 +1,21 @@
 package singleton
 
-import (
-	"sync"
-)
-
 /*
 单类模式严格一个类只有一个实例，并提供一个全局的访问接口
 *设计思想
 
 	1.声明一个全局变量
 	2.多线程考虑线程安全，引入sync.Once
+	3.sync.Once 不能重来，初始化失败也无法重试，测试之间也没法清掉状态，
+	  所以实例交给 Lazy 保管(见 lazy.go)，ResetForTesting 可以把它清掉
 */
 type singleton map[string]string
 
-var (
-	once     sync.Once
-	instance singleton
-)
+var instance = NewLazy(func() (singleton, error) {
+	return make(singleton), nil
+})
 
 func New() singleton {
-	once.Do(func() {
-		instance = make(singleton)
-	})
-	return instance
+	s, _ := instance.Get() // 初始化不会失败
+	return s
 }
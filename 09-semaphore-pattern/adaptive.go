@@ -0,0 +1,231 @@
+package semaphore
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+/*
+自适应并发限制
+设计思想：
+
+	固定的容量要么太小浪费下游的处理能力，要么太大把下游压垮，而且下游的能力一直在变
+	AdaptiveLimiter 在 Semaphore 外面加一层：调用方归还许可时用 ReleaseWith 报告这次调用的耗时和错误，
+	LimitAlgorithm 根据这些观测值计算新的上限，再用 SetCapacity 调整信号量的容量
+	1.AIMD：加性增、乘性减，成功且并发接近上限时加 1，失败或超时时乘以 BackoffRatio，
+	  只看错误不看延迟，适合下游会主动拒绝(限流、过载保护)的场景
+	2.Gradient：类似 TCP Vegas，记住见过的最小 RTT 作为无排队时的耗时，
+	  当前 RTT 越接近它说明排队越少，上限按 最小RTT/当前RTT 的比例(梯度)收缩，再加上 sqrt(上限) 的余量去试探，
+	  下游还没出错、只是开始排队变慢就能收紧
+	3.只有在并发用到上限的一半以上时才增长，调用方本身流量不大时不会把上限越推越高
+	上限始终夹在 MinLimit 和 MaxLimit 之间，缩容不会收回已经拿走的许可(见 capacity.go)
+*/
+
+// 一次调用的观测值
+type Sample struct {
+	RTT      time.Duration
+	InFlight int  // 这次调用结束前正在进行的调用数，包括它自己
+	Failed   bool // 调用返回了错误
+}
+
+// 根据观测值计算新的并发上限，由 AdaptiveLimiter 串行调用
+type LimitAlgorithm interface {
+	Update(limit float64, s Sample) float64
+}
+
+// 加性增、乘性减
+type AIMD struct {
+	BackoffRatio float64       // 失败时上限乘以这个比例，默认 0.9
+	MaxRTT       time.Duration // 耗时超过它也当作失败，不大于0时不检查
+}
+
+func (a *AIMD) Update(limit float64, s Sample) float64 {
+	if s.Failed || (a.MaxRTT > 0 && s.RTT > a.MaxRTT) {
+		backoff := a.BackoffRatio
+		if backoff <= 0 || backoff >= 1 {
+			backoff = 0.9
+		}
+		return limit * backoff
+	}
+	if float64(s.InFlight)*2 >= limit {
+		return limit + 1
+	}
+	return limit
+}
+
+// 按 最小RTT/当前RTT 的梯度调整上限
+type Gradient struct {
+	Tolerance  float64 // RTT 超过最小值的这个倍数才开始收缩，默认 1.5
+	Smoothing  float64 // 每个样本对上限的影响，默认 0.2
+	ProbeEvery int     // 每隔多少个样本重新测量最小 RTT，不大于0时不重新测量
+
+	minRTT  time.Duration
+	samples int
+}
+
+func (g *Gradient) Update(limit float64, s Sample) float64 {
+	if g.ProbeEvery > 0 {
+		if g.samples++; g.samples > g.ProbeEvery {
+			g.samples = 1
+			g.minRTT = 0
+		}
+	}
+	if s.Failed {
+		return limit / 2
+	}
+	if s.RTT <= 0 {
+		return limit
+	}
+	if g.minRTT == 0 || s.RTT < g.minRTT {
+		g.minRTT = s.RTT
+	}
+
+	tolerance := g.Tolerance
+	if tolerance < 1 {
+		tolerance = 1.5
+	}
+	smoothing := g.Smoothing
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = 0.2
+	}
+	gradient := math.Max(0.5, math.Min(1, tolerance*float64(g.minRTT)/float64(s.RTT)))
+	next := limit*gradient + math.Sqrt(limit)
+	if next > limit && float64(s.InFlight)*2 < limit {
+		return limit
+	}
+	return limit*(1-smoothing) + next*smoothing
+}
+
+// 自适应限制器的选项
+type AdaptiveOptions struct {
+	InitialLimit int           // 初始上限，默认 10
+	MinLimit     int           // 默认 1
+	MaxLimit     int           // 默认 1000
+	Timeout      time.Duration // Acquire 的等待时间，不大于0时一直等待
+}
+
+type AdaptiveLimiter struct {
+	sem  *Semaphore
+	alg  LimitAlgorithm
+	opts AdaptiveOptions
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+}
+
+var _ Interface = (*AdaptiveLimiter)(nil)
+
+func NewAdaptiveLimiter(alg LimitAlgorithm, opts AdaptiveOptions) *AdaptiveLimiter {
+	if opts.MinLimit < 1 {
+		opts.MinLimit = 1
+	}
+	if opts.MaxLimit < opts.MinLimit {
+		opts.MaxLimit = 1000
+		if opts.MaxLimit < opts.MinLimit {
+			opts.MaxLimit = opts.MinLimit
+		}
+	}
+	if opts.InitialLimit <= 0 {
+		opts.InitialLimit = 10
+	}
+	initial := opts.InitialLimit
+	if initial < opts.MinLimit {
+		initial = opts.MinLimit
+	}
+	if initial > opts.MaxLimit {
+		initial = opts.MaxLimit
+	}
+	return &AdaptiveLimiter{
+		sem:   NewSemaphore(initial, 0),
+		alg:   alg,
+		opts:  opts,
+		limit: float64(initial),
+	}
+}
+
+// 获取一个许可，最多等待 Timeout，不大于0时一直等待
+func (l *AdaptiveLimiter) Acquire() error {
+	ctx := context.Background()
+	if l.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.opts.Timeout)
+		defer cancel()
+	}
+	if err := l.sem.AcquireN(ctx, 1); err != nil {
+		return ErrNoTickets
+	}
+	l.started()
+	return nil
+}
+
+// 获取一个许可，等待直到 ctx 结束
+func (l *AdaptiveLimiter) AcquireContext(ctx context.Context) error {
+	if err := l.sem.AcquireN(ctx, 1); err != nil {
+		return err
+	}
+	l.started()
+	return nil
+}
+
+// 不等待地获取一个许可
+func (l *AdaptiveLimiter) TryAcquire() bool {
+	if !l.sem.TryAcquireN(1) {
+		return false
+	}
+	l.started()
+	return true
+}
+
+func (l *AdaptiveLimiter) started() {
+	l.mu.Lock()
+	l.inFlight++
+	l.mu.Unlock()
+}
+
+// 归还许可但不报告观测值，上限不变
+func (l *AdaptiveLimiter) Release() error {
+	if err := l.sem.Release(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.inFlight--
+	l.mu.Unlock()
+	return nil
+}
+
+// 归还许可并报告这次调用的耗时和错误，据此调整上限
+func (l *AdaptiveLimiter) ReleaseWith(rtt time.Duration, err error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if relErr := l.sem.Release(); relErr != nil {
+		return relErr
+	}
+	s := Sample{RTT: rtt, InFlight: l.inFlight, Failed: err != nil}
+	l.inFlight--
+
+	limit := l.alg.Update(l.limit, s)
+	limit = math.Max(float64(l.opts.MinLimit), math.Min(float64(l.opts.MaxLimit), limit))
+	if old := l.limit; int(limit) != int(old) {
+		// 容量不为负，SetCapacity 不会失败
+		_ = l.sem.SetCapacity(int(limit))
+	}
+	l.limit = limit
+	return nil
+}
+
+// 当前的并发上限
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// 正在进行的调用数
+func (l *AdaptiveLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
@@ -0,0 +1,146 @@
+package semaphore
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+var errOverload = errors.New("overloaded")
+
+// 模拟的下游：capacity 个工作者，超过后请求排队，耗时按并发线性增长；
+// 并发超过 shedAt 时直接拒绝，shedAt 为0时从不拒绝
+type simServer struct {
+	capacity int
+	base     time.Duration
+	shedAt   int
+}
+
+func (s simServer) call(inFlight int) (time.Duration, error) {
+	if s.shedAt > 0 && inFlight > s.shedAt {
+		return s.base / 10, errOverload
+	}
+	rtt := s.base
+	if inFlight > s.capacity {
+		rtt = s.base * time.Duration(inFlight) / time.Duration(s.capacity)
+	}
+	return rtt, nil
+}
+
+type simCall struct {
+	end time.Duration
+	rtt time.Duration
+	err error
+}
+
+// 离散事件模拟：调用方的请求源源不断，能拿到许可就立即发出，
+// 每完成一个调用就把结果报告给限制器，返回每次完成后的上限
+func simulate(l *AdaptiveLimiter, server simServer, calls int) []int {
+	var (
+		now      time.Duration
+		inFlight []simCall
+		history  []int
+	)
+	for len(history) < calls {
+		for l.TryAcquire() {
+			rtt, err := server.call(len(inFlight) + 1)
+			inFlight = append(inFlight, simCall{end: now + rtt, rtt: rtt, err: err})
+		}
+		sort.Slice(inFlight, func(i, j int) bool { return inFlight[i].end < inFlight[j].end })
+		c := inFlight[0]
+		inFlight = inFlight[1:]
+		now = c.end
+		_ = l.ReleaseWith(c.rtt, c.err)
+		history = append(history, l.Limit())
+	}
+	return history
+}
+
+// 后半段上限的平均值
+func settled(history []int) float64 {
+	tail := history[len(history)/2:]
+	sum := 0
+	for _, v := range tail {
+		sum += v
+	}
+	return float64(sum) / float64(len(tail))
+}
+
+// TestAIMDConverges 测试 AIMD 在下游开始拒绝的位置附近来回调整
+func TestAIMDConverges(t *testing.T) {
+	server := simServer{capacity: 20, base: 10 * time.Millisecond, shedAt: 20}
+	for _, initial := range []int{1, 200} {
+		l := NewAdaptiveLimiter(&AIMD{}, AdaptiveOptions{InitialLimit: initial})
+		avg := settled(simulate(l, server, 5000))
+		if avg < 10 || avg > 25 {
+			t.Errorf("initial %d: expected limit to settle near 20, got %.1f", initial, avg)
+		}
+	}
+}
+
+// TestAIMDMaxRTT 测试耗时过长也会收紧上限
+func TestAIMDMaxRTT(t *testing.T) {
+	server := simServer{capacity: 20, base: 10 * time.Millisecond}
+	l := NewAdaptiveLimiter(&AIMD{MaxRTT: 15 * time.Millisecond}, AdaptiveOptions{InitialLimit: 100})
+	avg := settled(simulate(l, server, 5000))
+	// 并发超过 30 时耗时超过 15ms
+	if avg < 10 || avg > 30 {
+		t.Errorf("expected limit to stay below 30, got %.1f", avg)
+	}
+}
+
+// TestGradientConverges 测试 Gradient 在延迟开始上升时停止增长，不需要下游报错
+func TestGradientConverges(t *testing.T) {
+	server := simServer{capacity: 20, base: 10 * time.Millisecond}
+	for _, initial := range []int{1, 200} {
+		l := NewAdaptiveLimiter(&Gradient{}, AdaptiveOptions{InitialLimit: initial})
+		avg := settled(simulate(l, server, 5000))
+		// 最多容忍 1.5 倍的排队
+		if avg < 20 || avg > 45 {
+			t.Errorf("initial %d: expected limit to settle above capacity without runaway, got %.1f", initial, avg)
+		}
+	}
+}
+
+// TestAdaptiveBounds 测试上限夹在 MinLimit 和 MaxLimit 之间
+func TestAdaptiveBounds(t *testing.T) {
+	l := NewAdaptiveLimiter(&AIMD{}, AdaptiveOptions{InitialLimit: 2, MinLimit: 2, MaxLimit: 3})
+	for i := 0; i < 10; i++ {
+		_ = l.Acquire()
+		_ = l.Acquire()
+		_ = l.ReleaseWith(time.Millisecond, nil)
+		_ = l.ReleaseWith(time.Millisecond, nil)
+	}
+	if got := l.Limit(); got != 3 {
+		t.Errorf("limit should stop at MaxLimit, got %d", got)
+	}
+	for i := 0; i < 10; i++ {
+		_ = l.Acquire()
+		_ = l.ReleaseWith(time.Millisecond, errOverload)
+	}
+	if got := l.Limit(); got != 2 {
+		t.Errorf("limit should stop at MinLimit, got %d", got)
+	}
+}
+
+// TestAdaptiveLimitsConcurrency 测试上限真正限制了并发，Release 不改变上限
+func TestAdaptiveLimitsConcurrency(t *testing.T) {
+	l := NewAdaptiveLimiter(&Gradient{}, AdaptiveOptions{InitialLimit: 2, Timeout: 10 * time.Millisecond})
+	_ = l.Acquire()
+	_ = l.Acquire()
+	if err := l.Acquire(); err != ErrNoTickets {
+		t.Fatalf("expected ErrNoTickets, got %v", err)
+	}
+	if l.InFlight() != 2 {
+		t.Errorf("expected 2 in flight, got %d", l.InFlight())
+	}
+	_ = l.Release()
+	_ = l.Release()
+	if err := l.Release(); err != ErrIllegalRelease {
+		t.Errorf("expected ErrIllegalRelease, got %v", err)
+	}
+	if l.Limit() != 2 || l.InFlight() != 0 {
+		t.Errorf("plain release should not change the limit, got %d", l.Limit())
+	}
+}
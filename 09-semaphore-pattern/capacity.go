@@ -0,0 +1,57 @@
+package semaphore
+
+/*
+运行时调整容量
+设计思想：
+
+	下游压力变化时需要随时放宽或收紧并发度：
+	1.扩容后立即按顺序唤醒等待者，之前因为请求超过容量而在等待的协程也会重新尝试
+	2.缩容不会收回已经拿走的许可，InUse 可能暂时大于 Capacity，
+	  在持有者归还到新容量以下之前，新的请求都拿不到许可
+	3.排队中的请求如果比新容量还大，会被移出队列，转为等待容量再次变大
+*/
+
+// 调整容量，n 不能为负
+func (s *Semaphore) SetCapacity(n int) error {
+	if n < 0 {
+		return ErrInvalidCount
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.size = n
+	close(s.resized)
+	s.resized = make(chan struct{})
+
+	for e := s.waiters.Front(); e != nil; {
+		next := e.Next()
+		if w := e.Value.(*waiter); w.n > n {
+			w.evicted = true
+			s.waiters.Remove(e)
+			close(w.ready)
+		}
+		e = next
+	}
+	s.notifyWaiters()
+	return nil
+}
+
+// 当前容量
+func (s *Semaphore) Capacity() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// 已经被拿走的许可数，缩容后可能大于 Capacity
+func (s *Semaphore) InUse() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cur
+}
+
+// 正在等待许可的协程数
+func (s *Semaphore) Waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.waiters.Len() + s.oversize
+}
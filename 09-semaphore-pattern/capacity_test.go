@@ -0,0 +1,118 @@
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestSetCapacityGrow 测试扩容后等待者被唤醒
+func TestSetCapacityGrow(t *testing.T) {
+	sem := NewSemaphore(1, time.Second)
+	_ = sem.Acquire()
+
+	got := make(chan error, 2)
+	go func() { got <- sem.AcquireN(context.Background(), 1) }()
+	go func() { got <- sem.AcquireN(context.Background(), 3) }() // 超过当前容量
+	waitFor(t, func() bool { return sem.Waiting() == 2 })
+
+	if err := sem.SetCapacity(5); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-got:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("waiters should be served after growing")
+		}
+	}
+	if sem.Capacity() != 5 || sem.InUse() != 5 {
+		t.Errorf("unexpected capacity %d in use %d", sem.Capacity(), sem.InUse())
+	}
+	if sem.Waiting() != 0 {
+		t.Errorf("expected no waiters, got %d", sem.Waiting())
+	}
+}
+
+// TestSetCapacityShrink 测试缩容不会收回已经拿走的许可，持有者归还到新容量以下之前拿不到许可
+func TestSetCapacityShrink(t *testing.T) {
+	sem := NewSemaphore(4, time.Second)
+	_ = sem.AcquireN(context.Background(), 4)
+	if err := sem.SetCapacity(2); err != nil {
+		t.Fatal(err)
+	}
+	if sem.InUse() != 4 || sem.Capacity() != 2 {
+		t.Fatalf("unexpected capacity %d in use %d", sem.Capacity(), sem.InUse())
+	}
+
+	_ = sem.ReleaseN(2)
+	if sem.TryAcquireN(1) {
+		t.Fatal("in use equals the new capacity, no ticket should be available")
+	}
+	acquired := make(chan struct{})
+	go func() {
+		_ = sem.Acquire()
+		close(acquired)
+	}()
+	waitFor(t, func() bool { return sem.Waiting() == 1 })
+
+	_ = sem.ReleaseN(1)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("waiter should get a ticket once holders drain below capacity")
+	}
+	if err := sem.SetCapacity(-1); err != ErrInvalidCount {
+		t.Errorf("expected ErrInvalidCount, got %v", err)
+	}
+}
+
+// TestSetCapacityEvictsOversized 测试比新容量还大的排队请求不会堵住后面的请求
+func TestSetCapacityEvictsOversized(t *testing.T) {
+	sem := NewSemaphore(4, time.Second)
+	_ = sem.AcquireN(context.Background(), 2)
+
+	big := make(chan error, 1)
+	go func() { big <- sem.AcquireN(context.Background(), 4) }()
+	waitFor(t, func() bool { return sem.Waiting() == 1 })
+	small := make(chan error, 1)
+	go func() { small <- sem.AcquireN(context.Background(), 1) }()
+	waitFor(t, func() bool { return sem.Waiting() == 2 })
+
+	_ = sem.SetCapacity(3)
+	select {
+	case err := <-small:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("small request should not be blocked by an oversized one")
+	}
+	// 被移出队列的大请求转为等待容量变大，仍然算在 Waiting 里
+	waitFor(t, func() bool { return sem.Waiting() == 1 })
+
+	_ = sem.ReleaseN(3)
+	_ = sem.SetCapacity(4)
+	select {
+	case err := <-big:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("big request should succeed after growing back")
+	}
+}
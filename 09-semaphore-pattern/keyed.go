@@ -0,0 +1,219 @@
+package semaphore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+按 key 限制并发
+设计思想：
+
+	"每个客户最多 3 个任务，总共最多 50 个"：每个 key 一个 Semaphore，外面再套一个全局的 Semaphore
+	1.key 的信号量在第一次使用时创建，不需要提前知道有哪些 key
+	2.先拿 key 的许可再拿全局许可，一个客户排队等自己的名额时不会占着全局名额，卡住其他客户
+	3.key 空闲(没有人持有也没有人等待)超过 idle 后被删除，下次使用时重新创建，
+	  删除是在访问时顺带检查的，不需要后台协程
+	4.Stats 返回每个 key 的使用情况
+	正在获取许可的调用会把 key 钉住，避免刚拿到的信号量被删除、同一个 key 出现两个信号量
+*/
+
+// 按 key 限制并发的选项
+type KeyedOption func(*KeyedSemaphore)
+
+// key 空闲多久后删除，默认不大于0，即归还最后一个许可时立即删除
+func WithIdleTimeout(d time.Duration) KeyedOption {
+	return func(k *KeyedSemaphore) {
+		k.idle = d
+	}
+}
+
+// 一个 key 的使用情况
+type KeyStats struct {
+	InUse    int       // 已经拿走的许可数
+	Waiting  int       // 正在等待的协程数
+	Acquired uint64    // 累计获取成功的次数
+	LastUsed time.Time // 最近一次获取或归还的时间
+}
+
+type keyEntry struct {
+	sem      *Semaphore
+	pending  int // 正在获取许可的调用数，由 KeyedSemaphore.mu 保护
+	acquired uint64
+	lastUsed time.Time
+}
+
+type KeyedSemaphore struct {
+	perKey int
+	global *Semaphore // 全局不限制时为 nil
+	idle   time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]*keyEntry
+	lastSweep time.Time
+}
+
+// 每个 key 最多 perKey 个许可，所有 key 加起来最多 global 个，global 不大于0时不限制总数
+func NewKeyedSemaphore(perKey, global int, opts ...KeyedOption) *KeyedSemaphore {
+	k := &KeyedSemaphore{
+		perKey:    perKey,
+		keys:      make(map[string]*keyEntry),
+		lastSweep: time.Now(),
+	}
+	if global > 0 {
+		k.global = NewSemaphore(global, 0)
+	}
+	for _, opt := range opts {
+		opt(k)
+	}
+	return k
+}
+
+// 找到或创建 key 的信号量并钉住它，调用方用完后需要调用 unpin
+func (k *KeyedSemaphore) pin(key string) *keyEntry {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := time.Now()
+	if k.idle > 0 && now.Sub(k.lastSweep) >= k.idle {
+		k.sweepLocked(now)
+	}
+	e := k.keys[key]
+	if e == nil {
+		e = &keyEntry{sem: NewSemaphore(k.perKey, 0), lastUsed: now}
+		k.keys[key] = e
+	}
+	e.pending++
+	return e
+}
+
+func (k *KeyedSemaphore) unpin(key string, e *keyEntry, acquired bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	e.pending--
+	e.lastUsed = time.Now()
+	if acquired {
+		e.acquired++
+	}
+	k.evictIfIdleLocked(key, e)
+}
+
+// 立即删除模式下，空闲的 key 马上删除，调用方需持有 k.mu
+func (k *KeyedSemaphore) evictIfIdleLocked(key string, e *keyEntry) {
+	if k.idle <= 0 && e.pending == 0 && e.sem.InUse() == 0 && k.keys[key] == e {
+		delete(k.keys, key)
+	}
+}
+
+// 删除空闲超过 idle 的 key，调用方需持有 k.mu
+func (k *KeyedSemaphore) sweepLocked(now time.Time) {
+	k.lastSweep = now
+	for key, e := range k.keys {
+		if e.pending == 0 && e.sem.InUse() == 0 && now.Sub(e.lastUsed) >= k.idle {
+			delete(k.keys, key)
+		}
+	}
+}
+
+// 获取 key 的一个许可，等待直到 ctx 结束
+func (k *KeyedSemaphore) Acquire(ctx context.Context, key string) error {
+	return k.AcquireN(ctx, key, 1)
+}
+
+// 获取 key 的 n 个许可，先等 key 的许可再等全局许可，失败时返回 ctx.Err()
+func (k *KeyedSemaphore) AcquireN(ctx context.Context, key string, n int) error {
+	if n < 0 {
+		return ErrInvalidCount
+	}
+	e := k.pin(key)
+	err := e.sem.AcquireN(ctx, n)
+	if err == nil && k.global != nil {
+		if err = k.global.AcquireN(ctx, n); err != nil {
+			_ = e.sem.ReleaseN(n)
+		}
+	}
+	k.unpin(key, e, err == nil)
+	return err
+}
+
+// 不等待地获取 key 的 n 个许可
+func (k *KeyedSemaphore) TryAcquireN(key string, n int) bool {
+	e := k.pin(key)
+	ok := e.sem.TryAcquireN(n)
+	if ok && k.global != nil && !k.global.TryAcquireN(n) {
+		_ = e.sem.ReleaseN(n)
+		ok = false
+	}
+	k.unpin(key, e, ok)
+	return ok
+}
+
+// 归还 key 的一个许可
+func (k *KeyedSemaphore) Release(key string) error {
+	return k.ReleaseN(key, 1)
+}
+
+// 归还 key 的 n 个许可，归还的比拿走的多时返回 ErrIllegalRelease
+func (k *KeyedSemaphore) ReleaseN(key string, n int) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	e := k.keys[key]
+	if e == nil {
+		return ErrIllegalRelease
+	}
+	if err := e.sem.ReleaseN(n); err != nil {
+		return err
+	}
+	if k.global != nil {
+		// 全局拿走的许可不少于 key 上拿走的，不会失败
+		_ = k.global.ReleaseN(n)
+	}
+	e.lastUsed = time.Now()
+	k.evictIfIdleLocked(key, e)
+	return nil
+}
+
+// 一个 key 的使用情况，key 不存在(从未使用或已被删除)时返回 false
+func (k *KeyedSemaphore) KeyStats(key string) (KeyStats, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	e := k.keys[key]
+	if e == nil {
+		return KeyStats{}, false
+	}
+	return e.stats(), true
+}
+
+// 所有 key 的使用情况
+func (k *KeyedSemaphore) Stats() map[string]KeyStats {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	stats := make(map[string]KeyStats, len(k.keys))
+	for key, e := range k.keys {
+		stats[key] = e.stats()
+	}
+	return stats
+}
+
+func (e *keyEntry) stats() KeyStats {
+	return KeyStats{
+		InUse:    e.sem.InUse(),
+		Waiting:  e.sem.Waiting(),
+		Acquired: e.acquired,
+		LastUsed: e.lastUsed,
+	}
+}
+
+// 所有 key 加起来已经拿走的许可数
+func (k *KeyedSemaphore) InUse() int {
+	if k.global != nil {
+		return k.global.InUse()
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	n := 0
+	for _, e := range k.keys {
+		n += e.sem.InUse()
+	}
+	return n
+}
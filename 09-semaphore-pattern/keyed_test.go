@@ -0,0 +1,140 @@
+package semaphore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestKeyedLimits 测试每个 key 和全局的限制同时生效
+func TestKeyedLimits(t *testing.T) {
+	k := NewKeyedSemaphore(2, 3)
+	if !k.TryAcquireN("a", 2) {
+		t.Fatal("a should get its 2 tickets")
+	}
+	if k.TryAcquireN("a", 1) {
+		t.Error("a is at its per-key limit")
+	}
+	if !k.TryAcquireN("b", 1) {
+		t.Fatal("b should get a ticket")
+	}
+	if k.TryAcquireN("c", 1) {
+		t.Error("global limit reached")
+	}
+	if st, _ := k.KeyStats("c"); st.InUse != 0 {
+		t.Errorf("failed acquire should not hold a key ticket, got %d", st.InUse)
+	}
+	if k.InUse() != 3 {
+		t.Errorf("expected 3 in use, got %d", k.InUse())
+	}
+
+	_ = k.Release("a")
+	if !k.TryAcquireN("c", 1) {
+		t.Error("c should get the released global ticket")
+	}
+}
+
+// TestKeyedConcurrency 测试并发下每个 key 和全局都不超过限制
+func TestKeyedConcurrency(t *testing.T) {
+	const perKey, global = 3, 5
+	k := NewKeyedSemaphore(perKey, global, WithIdleTimeout(time.Millisecond))
+
+	var (
+		mu     sync.Mutex
+		active = map[string]int{}
+		total  int
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < 40; i++ {
+		key := string(rune('a' + i%4))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := k.Acquire(context.Background(), key); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			active[key]++
+			total++
+			if active[key] > perKey || total > global {
+				t.Errorf("limit exceeded: key %s=%d total=%d", key, active[key], total)
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			active[key]--
+			total--
+			mu.Unlock()
+			if err := k.Release(key); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if k.InUse() != 0 {
+		t.Errorf("all tickets should be returned, got %d", k.InUse())
+	}
+}
+
+// TestKeyedEviction 测试空闲的 key 被删除
+func TestKeyedEviction(t *testing.T) {
+	k := NewKeyedSemaphore(1, 0)
+	_ = k.Acquire(context.Background(), "a")
+	if _, ok := k.KeyStats("a"); !ok {
+		t.Fatal("key should exist while held")
+	}
+	_ = k.Release("a")
+	if _, ok := k.KeyStats("a"); ok {
+		t.Error("idle key should be evicted immediately by default")
+	}
+	if err := k.Release("a"); err != ErrIllegalRelease {
+		t.Errorf("expected ErrIllegalRelease, got %v", err)
+	}
+
+	k = NewKeyedSemaphore(1, 0, WithIdleTimeout(20*time.Millisecond))
+	_ = k.Acquire(context.Background(), "a")
+	_ = k.Release("a")
+	_ = k.Acquire(context.Background(), "b") // b 一直持有，不会被删除
+	if _, ok := k.KeyStats("a"); !ok {
+		t.Fatal("key should be kept until idle timeout")
+	}
+	time.Sleep(30 * time.Millisecond)
+	_ = k.Acquire(context.Background(), "c") // 访问时顺带清理
+	stats := k.Stats()
+	if _, ok := stats["a"]; ok {
+		t.Error("a should be evicted after idle timeout")
+	}
+	if _, ok := stats["b"]; !ok {
+		t.Error("b is held and should not be evicted")
+	}
+}
+
+// TestKeyedStats 测试每个 key 的统计
+func TestKeyedStats(t *testing.T) {
+	k := NewKeyedSemaphore(1, 10, WithIdleTimeout(time.Hour))
+	_ = k.Acquire(context.Background(), "a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- k.Acquire(ctx, "a") }()
+	waitFor(t, func() bool {
+		st, _ := k.KeyStats("a")
+		return st.Waiting == 1
+	})
+	st, _ := k.KeyStats("a")
+	if st.InUse != 1 || st.Acquired != 1 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	_ = k.Release("a")
+	st, _ = k.KeyStats("a")
+	if st.InUse != 0 || st.Waiting != 0 || st.Acquired != 1 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
@@ -0,0 +1,50 @@
+package semaphore
+
+import "time"
+
+// 漏桶：请求按 interval 的间隔依次放行，最多 capacity 个请求在桶里排队，桶满时拒绝
+type leakyBucket struct {
+	interval time.Duration
+	capacity int
+	next     time.Time // 下一个名额的放行时间
+}
+
+// 每秒放行 rate 个请求，最多 capacity 个排队
+func NewLeakyBucket(rate float64, capacity int, opts ...LimiterOption) Limiter {
+	var interval time.Duration
+	if rate > 0 {
+		interval = time.Duration(float64(time.Second) / rate)
+	}
+	return newRateLimiter(&leakyBucket{interval: interval, capacity: capacity}, opts)
+}
+
+func (lb *leakyBucket) reserve(now time.Time) (time.Time, bool) {
+	if lb.interval <= 0 {
+		return time.Time{}, false
+	}
+	at := lb.next
+	if at.Before(now) {
+		at = now
+	}
+	// 排在前面、还没放行的请求数
+	if queued := int(at.Sub(now) / lb.interval); queued > lb.capacity {
+		return time.Time{}, false
+	}
+	lb.next = at.Add(lb.interval)
+	return at, true
+}
+
+func (lb *leakyBucket) allow(now time.Time) bool {
+	if lb.interval <= 0 || lb.next.After(now) {
+		return false
+	}
+	lb.next = now.Add(lb.interval)
+	return true
+}
+
+// 只有最后一个预约可以把名额还回去，中间的空位会被后面的请求等掉
+func (lb *leakyBucket) cancel(at, now time.Time) {
+	if lb.next.Sub(at) == lb.interval {
+		lb.next = at
+	}
+}
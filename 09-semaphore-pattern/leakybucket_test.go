@@ -0,0 +1,63 @@
+package semaphore
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLeakyBucketSmooth 测试漏桶按固定间隔放行，没有突发
+func TestLeakyBucketSmooth(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	l := NewLeakyBucket(10, 5, WithClock(clock))
+	if !l.Allow() {
+		t.Fatal("first call should be allowed")
+	}
+	if l.Allow() {
+		t.Fatal("leaky bucket should not allow bursts")
+	}
+	clock.Advance(100 * time.Millisecond)
+	if !l.Allow() {
+		t.Error("next slot should open after one interval")
+	}
+
+	for i := 1; i <= 3; i++ {
+		if d := l.Reserve().Delay(); d != time.Duration(i)*100*time.Millisecond {
+			t.Errorf("reservation %d: got %v", i, d)
+		}
+	}
+}
+
+// TestLeakyBucketOverflow 测试排队超过容量时拒绝
+func TestLeakyBucketOverflow(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	l := NewLeakyBucket(10, 2, WithClock(clock))
+	for i := 0; i < 3; i++ {
+		if !l.Reserve().OK() {
+			t.Fatalf("reservation %d should fit", i)
+		}
+	}
+	r := l.Reserve()
+	if r.OK() {
+		t.Fatal("bucket should overflow")
+	}
+	if r.Delay() != 0 {
+		t.Error("failed reservation should not wait")
+	}
+
+	clock.Advance(100 * time.Millisecond)
+	if !l.Reserve().OK() {
+		t.Error("bucket should have leaked one slot")
+	}
+}
+
+// TestLeakyBucketCancel 测试取消最后一个预约
+func TestLeakyBucketCancel(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	l := NewLeakyBucket(10, 5, WithClock(clock))
+	l.Reserve()
+	r := l.Reserve()
+	r.Cancel()
+	if d := l.Reserve().Delay(); d != 100*time.Millisecond {
+		t.Errorf("canceled slot should be reused, got %v", d)
+	}
+}
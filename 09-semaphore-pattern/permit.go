@@ -0,0 +1,106 @@
+package semaphore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+/*
+许可凭证与泄漏排查
+设计思想：
+
+	AcquireN/ReleaseN 只是计数，哪里拿了许可忘了还、哪里还了两次都查不出来
+	1.AcquirePermit 返回一个 Permit，许可跟着凭证走，Permit.Release 可以重复调用，只有第一次生效
+	2.WithDebug 打开调试模式后，每个未归还的凭证都会记下获取时的调用栈，
+	  DumpPermits 可以随时把它们打印出来，找到泄漏的地方
+	调用栈只在调试模式下记录，平时只多一次内存分配
+*/
+
+// 许可凭证
+type Permit struct {
+	s        *Semaphore
+	n        int
+	released bool // 由 s.mu 保护
+}
+
+// 未归还凭证的信息，只在调试模式下记录
+type PermitInfo struct {
+	N        int
+	Acquired time.Time
+	Stack    string
+}
+
+// 信号量选项，函数式选项模式
+type Option func(*Semaphore)
+
+// 调试模式：记录每个未归还凭证的调用栈
+func WithDebug() Option {
+	return func(s *Semaphore) {
+		s.permits = make(map[*Permit]PermitInfo)
+	}
+}
+
+// 获取 n 个许可，返回对应的凭证
+func (s *Semaphore) AcquirePermit(ctx context.Context, n int) (*Permit, error) {
+	if err := s.AcquireN(ctx, n); err != nil {
+		return nil, err
+	}
+	p := &Permit{s: s, n: n}
+	if s.permits != nil {
+		info := PermitInfo{N: n, Acquired: time.Now(), Stack: string(debug.Stack())}
+		s.mu.Lock()
+		s.permits[p] = info
+		s.mu.Unlock()
+	}
+	return p, nil
+}
+
+// 归还凭证对应的许可，可以重复调用，只有第一次生效
+func (p *Permit) Release() error {
+	s := p.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.released {
+		return nil
+	}
+	p.released = true
+	delete(s.permits, p)
+	return s.releaseLocked(p.n)
+}
+
+// 所有未归还的凭证，按获取时间排序，没有开启调试模式时返回 nil
+func (s *Semaphore) OutstandingPermits() []PermitInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.permits == nil {
+		return nil
+	}
+	infos := make([]PermitInfo, 0, len(s.permits))
+	for _, info := range s.permits {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Acquired.Before(infos[j].Acquired)
+	})
+	return infos
+}
+
+// 把未归还的凭证和它们的调用栈写到 w
+func (s *Semaphore) DumpPermits(w io.Writer) error {
+	infos := s.OutstandingPermits()
+	if _, err := fmt.Fprintf(w, "semaphore: %d outstanding permits\n", len(infos)); err != nil {
+		return err
+	}
+	for i, info := range infos {
+		_, err := fmt.Fprintf(w, "\npermit #%d: %d tickets, held for %v\n%s",
+			i+1, info.N, time.Since(info.Acquired).Round(time.Millisecond), info.Stack)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
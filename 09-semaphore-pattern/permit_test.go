@@ -0,0 +1,86 @@
+package semaphore
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestReleaseWithoutAcquire 测试多余的归还立即失败，不会等待 timeout
+func TestReleaseWithoutAcquire(t *testing.T) {
+	sem := New(1, time.Second)
+	start := time.Now()
+	if err := sem.Release(); err != ErrIllegalRelease {
+		t.Errorf("expected ErrIllegalRelease, got %v", err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("illegal release should fail immediately, took %v", d)
+	}
+}
+
+// TestPermitRelease 测试凭证可以重复归还
+func TestPermitRelease(t *testing.T) {
+	sem := NewSemaphore(2, time.Second)
+	p, err := sem.AcquirePermit(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sem.TryAcquireN(1) {
+		t.Fatal("all tickets should be held by the permit")
+	}
+	if err := p.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Release(); err != nil {
+		t.Errorf("second release should be a no-op, got %v", err)
+	}
+	if !sem.TryAcquireN(2) {
+		t.Error("tickets should be available after release")
+	}
+	// 第二次归还没有多还许可
+	if err := sem.ReleaseN(3); err != ErrIllegalRelease {
+		t.Errorf("expected ErrIllegalRelease, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := sem.AcquirePermit(ctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func leakPermit(s *Semaphore) *Permit {
+	p, _ := s.AcquirePermit(context.Background(), 1)
+	return p
+}
+
+// TestDumpPermits 测试调试模式下打印未归还凭证的调用栈
+func TestDumpPermits(t *testing.T) {
+	sem := NewSemaphore(3, time.Second, WithDebug())
+	p1 := leakPermit(sem)
+	p2, _ := sem.AcquirePermit(context.Background(), 2)
+
+	if infos := sem.OutstandingPermits(); len(infos) != 2 || infos[0].N != 1 || infos[1].N != 2 {
+		t.Fatalf("unexpected outstanding permits %+v", infos)
+	}
+	_ = p2.Release()
+
+	var buf bytes.Buffer
+	if err := sem.DumpPermits(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "1 outstanding permits") || !strings.Contains(out, "leakPermit") {
+		t.Errorf("dump should show the leaking call site:\n%s", out)
+	}
+
+	_ = p1.Release()
+	if infos := sem.OutstandingPermits(); len(infos) != 0 {
+		t.Errorf("expected no outstanding permits, got %d", len(infos))
+	}
+	if infos := NewSemaphore(1, time.Second).OutstandingPermits(); infos != nil {
+		t.Error("permits are only tracked in debug mode")
+	}
+}
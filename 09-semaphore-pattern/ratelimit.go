@@ -0,0 +1,155 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+/*
+限流器
+设计思想：
+
+	信号量限制的是"同时有多少个"，限流器限制的是"每段时间有多少个"
+	三种算法共用同一套接口 Limiter，并且兼容 Interface，可以直接替换信号量：
+		令牌桶(TokenBucket)        按固定速率往桶里放令牌，桶满为止，允许一定的突发
+		漏桶(LeakyBucket)          请求排队，按固定间隔一个一个放出去，输出绝对平滑，队列满了就拒绝
+		滑动窗口日志(SlidingWindow) 记录每个请求的时间，任意一个窗口内最多 N 个，没有固定窗口边界的突刺
+	每种算法只需要实现 reserve/allow/cancel 三个方法，等待、取消、时钟这些公共逻辑都在这里
+	1.Reserve 预约一个名额，返回需要等待多久，不想等了可以 Cancel 把名额还回去
+	2.Wait 预约并等待，ctx 结束时自动取消预约
+	3.Allow 只在不需要等待时拿走名额
+	4.Acquire 就是不限时的 Wait，Release 什么都不做：名额随着时间恢复，不需要归还
+	时钟可以通过 WithClock 换成 FakeClock，测试时不需要真的 sleep
+*/
+var ErrRateLimited = errors.New("semaphore: rate limit exceeded")
+
+type Limiter interface {
+	Interface
+	Wait(ctx context.Context) error
+	Allow() bool
+	Reserve() *Reservation
+}
+
+// 限流算法，调用方持有锁，now 由时钟提供
+type algorithm interface {
+	// 预约一个名额，返回可以执行的时间，永远不可能满足时返回 false
+	reserve(now time.Time) (time.Time, bool)
+	// 不需要等待时拿走名额
+	allow(now time.Time) bool
+	// 取消在 at 执行的预约
+	cancel(at, now time.Time)
+}
+
+// 限流器选项
+type LimiterOption func(*rateLimiter)
+
+// 使用指定的时钟，默认是真实时间
+func WithClock(c Clock) LimiterOption {
+	return func(l *rateLimiter) {
+		l.clock = c
+	}
+}
+
+type rateLimiter struct {
+	mu    sync.Mutex
+	clock Clock
+	alg   algorithm
+}
+
+func newRateLimiter(alg algorithm, opts []LimiterOption) *rateLimiter {
+	l := &rateLimiter{clock: realClock{}, alg: alg}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// 一次预约
+type Reservation struct {
+	l        *rateLimiter
+	ok       bool
+	at       time.Time
+	canceled bool
+}
+
+// 预约是否成功，失败时不需要等待也不需要取消
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// 还需要等待多久
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return 0
+	}
+	if d := r.at.Sub(r.l.clock.Now()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// 放弃预约，名额还给限流器，已经到时间的预约无法取消
+func (r *Reservation) Cancel() {
+	if !r.ok {
+		return
+	}
+	r.l.mu.Lock()
+	defer r.l.mu.Unlock()
+	if r.canceled {
+		return
+	}
+	r.canceled = true
+	if now := r.l.clock.Now(); r.at.After(now) {
+		r.l.alg.cancel(r.at, now)
+	}
+}
+
+func (l *rateLimiter) Reserve() *Reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	at, ok := l.alg.reserve(l.clock.Now())
+	return &Reservation{l: l, ok: ok, at: at}
+}
+
+func (l *rateLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.alg.allow(l.clock.Now())
+}
+
+// 等待一个名额，ctx 结束时取消预约并返回 ctx.Err()
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r := l.Reserve()
+	if !r.OK() {
+		return ErrRateLimited
+	}
+	d := r.Delay()
+	if d == 0 {
+		return nil
+	}
+	select {
+	case <-l.clock.After(d):
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
+
+// 等待一个名额，永远不可能满足时返回 ErrNoTickets
+func (l *rateLimiter) Acquire() error {
+	if err := l.Wait(context.Background()); err != nil {
+		return ErrNoTickets
+	}
+	return nil
+}
+
+// 名额随时间恢复，不需要归还
+func (l *rateLimiter) Release() error {
+	return nil
+}
@@ -0,0 +1,118 @@
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// 等到有 n 个协程在 FakeClock 上等待
+func sleepers(t *testing.T, c *FakeClock, n int) {
+	t.Helper()
+	waitFor(t, func() bool { return c.Waiters() == n })
+}
+
+// TestLimiterInterface 测试限流器可以当作信号量使用，Release 什么都不做
+func TestLimiterInterface(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	limiters := map[string]Limiter{
+		"token":   NewTokenBucket(1, 1, WithClock(clock)),
+		"leaky":   NewLeakyBucket(1, 1, WithClock(clock)),
+		"sliding": NewSlidingWindow(1, time.Second, WithClock(clock)),
+	}
+	for name, l := range limiters {
+		var sem Interface = l
+		if err := sem.Acquire(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if err := sem.Release(); err != nil {
+			t.Errorf("%s: release should be a no-op, got %v", name, err)
+		}
+		if l.Allow() {
+			t.Errorf("%s: release should not give the slot back", name)
+		}
+	}
+}
+
+// TestWait 测试 Wait 按时钟等待
+func TestWait(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	l := NewTokenBucket(10, 1, WithClock(clock))
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- l.Wait(context.Background()) }()
+	sleepers(t, clock, 1)
+	select {
+	case <-done:
+		t.Fatal("wait should block until the next token")
+	default:
+	}
+	clock.Advance(100 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestWaitCancel 测试 ctx 结束时预约被取消，名额还给后来的请求
+func TestWaitCancel(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	l := NewSlidingWindow(1, time.Second, WithClock(clock))
+	if !l.Allow() {
+		t.Fatal("first call should be allowed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- l.Wait(ctx) }()
+	sleepers(t, clock, 1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if !l.Allow() {
+		t.Error("canceled reservation should not hold the slot")
+	}
+}
+
+// TestReservation 测试预约的等待时间与取消
+func TestReservation(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	l := NewTokenBucket(1, 1, WithClock(clock))
+	if r := l.Reserve(); !r.OK() || r.Delay() != 0 {
+		t.Fatalf("first reservation should be immediate, got %v", r.Delay())
+	}
+	r := l.Reserve()
+	if !r.OK() || r.Delay() != time.Second {
+		t.Fatalf("expected 1s delay, got %v", r.Delay())
+	}
+	clock.Advance(400 * time.Millisecond)
+	if d := r.Delay(); d != 600*time.Millisecond {
+		t.Errorf("delay should shrink with time, got %v", d)
+	}
+	r.Cancel()
+	r.Cancel()
+	if d := l.Reserve().Delay(); d != 600*time.Millisecond {
+		t.Errorf("canceled token should be reused, got %v", d)
+	}
+}
+
+// TestWaitRejected 测试永远不可能满足的请求立即失败
+func TestWaitRejected(t *testing.T) {
+	l := NewTokenBucket(1, 0)
+	if err := l.Wait(context.Background()); err != ErrRateLimited {
+		t.Errorf("expected ErrRateLimited, got %v", err)
+	}
+	if err := l.Acquire(); err != ErrNoTickets {
+		t.Errorf("expected ErrNoTickets, got %v", err)
+	}
+	if r := l.Reserve(); r.OK() {
+		t.Error("reservation should fail")
+	}
+}
@@ -1,7 +1,10 @@
 package semaphore
 
 import (
+	"container/list"
+	"context"
 	"errors"
+	"sync"
 	"time"
 )
 
@@ -16,13 +19,22 @@ import (
 设计思想：
 
 	1.定义接口包含Acquire和release行为
-	2.定义结构体， 包含chan和过期时间属性
-	3. 在Acquire中实现channel读入
-	4. 在release中channel 读出， 阻塞超时返回错误
+	2.定义结构体，包含容量、已占用数量和等待队列，用互斥锁保护
+	3.AcquireN 一次获取 n 个许可，不够时排进先进先出的等待队列，直到 ctx 结束
+	4.ReleaseN 归还许可，按顺序唤醒排在队首的等待者
+	5.Acquire、Release 是 n 为 1、等待时间为构造时 timeout 的简写，timeout 不大于0时和原来一样不等待，拿不到立即返回 ErrNoTickets
+	6.容量可以在运行时调整(见 capacity.go)
+	7.归还的比拿走的多是调用方的bug，立即返回 ErrIllegalRelease，不会阻塞(见 permit.go 的凭证模式)
+
+	原来用带缓冲的 chan 实现，chan 的缓冲区大小就是容量，但一次只能拿一个许可，
+	多个许可只能循环获取，拿到一半时还会和别人互相卡住
+	等待队列是严格先进先出的：队首要 10 个许可而当前只剩 3 个时，后面只要 1 个的也得排队，
+	否则源源不断的小请求会让大请求永远拿不到许可
 */
 var (
 	ErrNoTickets      = errors.New("semaphore: could not acquire semaphore")
 	ErrIllegalRelease = errors.New("semaphore: can't release semaphore without acquiring it first")
+	ErrInvalidCount   = errors.New("semaphore: negative count")
 )
 
 type Interface interface {
@@ -30,33 +42,175 @@ type Interface interface {
 	Release() error
 }
 
-// 定义结构体， 信号量使用chan struct{}
+// 排队等待的请求，ready 在拿到许可或被移出队列后关闭
+type waiter struct {
+	n       int
+	ready   chan struct{}
+	evicted bool // 容量缩小到放不下这个请求，被移出了队列，需要重新等待
+}
+
+// 定义结构体，信号量是一个带等待队列的计数器
 type Semaphore struct {
-	sem     chan struct{}
-	timeout time.Duration
+	size     int
+	cur      int
+	timeout  time.Duration // Acquire 的等待时间，不大于0时不等待
+	mu       sync.Mutex
+	waiters  list.List              // 元素为 *waiter
+	permits  map[*Permit]PermitInfo // 调试模式下记录未归还的凭证
+	resized  chan struct{}          // 容量变化时关闭并换一个新的
+	oversize int                    // 请求超过容量、在等容量变大的协程数
 }
 
+// 获取一个许可，最多等待 timeout，timeout 不大于0时拿不到立即返回 ErrNoTickets
+// 需要一直等待时用 AcquireN(context.Background(), 1)
 func (s *Semaphore) Acquire() error {
-	select {
-	case s.sem <- struct{}{}: // 尝试发送一个值到 channel
+	if s.timeout <= 0 {
+		if !s.TryAcquireN(1) {
+			return ErrNoTickets
+		}
 		return nil
-	case <-time.After(s.timeout): // 如果超时
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if err := s.AcquireN(ctx, 1); err != nil {
 		return ErrNoTickets
 	}
+	return nil
 }
 
+// 归还一个许可
 func (s *Semaphore) Release() error {
-	select {
-	case <-s.sem:
-		return nil
-	case <-time.After(s.timeout):
+	return s.ReleaseN(1)
+}
+
+// 获取 n 个许可，不够时排队等待直到 ctx 结束，返回 ctx.Err()
+// n 大于容量时不排队，一直等到容量变大或 ctx 结束
+func (s *Semaphore) AcquireN(ctx context.Context, n int) error {
+	if n < 0 {
+		return ErrInvalidCount
+	}
+	done := ctx.Done()
+
+	s.mu.Lock()
+	for {
+		// 没有人排队并且许可足够时直接拿走，有人排队时即使够也要排在后面
+		if s.size-s.cur >= n && s.waiters.Len() == 0 {
+			s.cur += n
+			s.mu.Unlock()
+			return nil
+		}
+		if n > s.size {
+			resized := s.resized
+			s.oversize++
+			s.mu.Unlock()
+			select {
+			case <-resized:
+			case <-done:
+				s.mu.Lock()
+				s.oversize--
+				s.mu.Unlock()
+				return ctx.Err()
+			}
+			s.mu.Lock()
+			s.oversize--
+			continue
+		}
+
+		w := &waiter{n: n, ready: make(chan struct{})}
+		elem := s.waiters.PushBack(w)
+		s.mu.Unlock()
+
+		select {
+		case <-w.ready:
+		case <-done:
+			s.mu.Lock()
+			select {
+			case <-w.ready:
+				// ctx 结束的同时已经拿到了许可，当作成功，避免许可被吞掉
+				if !w.evicted {
+					s.mu.Unlock()
+					return nil
+				}
+				s.mu.Unlock()
+				return ctx.Err()
+			default:
+			}
+			isFront := s.waiters.Front() == elem
+			s.waiters.Remove(elem)
+			// 队首放弃了，后面的等待者可能已经可以拿到许可
+			if isFront && s.size > s.cur {
+				s.notifyWaiters()
+			}
+			s.mu.Unlock()
+			return ctx.Err()
+		}
+
+		s.mu.Lock()
+		if !w.evicted {
+			s.mu.Unlock()
+			return nil
+		}
+	}
+}
+
+// 不等待地获取 n 个许可，有人在排队时也会失败
+func (s *Semaphore) TryAcquireN(n int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n < 0 || s.size-s.cur < n || s.waiters.Len() > 0 {
+		return false
+	}
+	s.cur += n
+	return true
+}
+
+// 归还 n 个许可，归还的比已经拿走的多时立即返回 ErrIllegalRelease，不做任何改动
+func (s *Semaphore) ReleaseN(n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.releaseLocked(n)
+}
+
+// 同 ReleaseN，调用方需持有锁
+func (s *Semaphore) releaseLocked(n int) error {
+	if n < 0 || n > s.cur {
 		return ErrIllegalRelease
 	}
+	s.cur -= n
+	s.notifyWaiters()
+	return nil
 }
 
-func New(tickets int, timeout time.Duration) Interface {
-	return &Semaphore{
-		sem:     make(chan struct{}, tickets), // 核心！缓冲区的大小，就是信号量的容量
+// 按顺序唤醒等待者，队首拿不到时停止，调用方需持有锁
+func (s *Semaphore) notifyWaiters() {
+	for {
+		next := s.waiters.Front()
+		if next == nil {
+			return
+		}
+		w := next.Value.(*waiter)
+		if s.size-s.cur < w.n {
+			return
+		}
+		s.cur += w.n
+		s.waiters.Remove(next)
+		close(w.ready)
+	}
+}
+
+// 创建容量为 tickets 的信号量，Acquire 最多等待 timeout，不大于0时不等待
+func NewSemaphore(tickets int, timeout time.Duration, opts ...Option) *Semaphore {
+	s := &Semaphore{
+		size:    tickets,
 		timeout: timeout,
+		resized: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
+}
+
+func New(tickets int, timeout time.Duration) Interface {
+	return NewSemaphore(tickets, timeout)
 }
@@ -1,6 +1,7 @@
 package semaphore
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -32,3 +33,151 @@ func TestNoTicket(t *testing.T) {
 		}
 	}
 }
+
+// TestZeroTimeoutFailsFast 测试 timeout 为0时 Acquire 不等待
+func TestZeroTimeoutFailsFast(t *testing.T) {
+	sem := New(1, 0)
+	if err := sem.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- sem.Acquire() }()
+	select {
+	case err := <-done:
+		if err != ErrNoTickets {
+			t.Errorf("Acquire = %v, want ErrNoTickets", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Acquire with zero timeout should not wait")
+	}
+}
+
+// TestAcquireN 测试一次获取多个许可
+func TestAcquireN(t *testing.T) {
+	sem := NewSemaphore(5, time.Second)
+	ctx := context.Background()
+
+	if err := sem.AcquireN(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if sem.TryAcquireN(3) {
+		t.Error("only 2 tickets left, TryAcquireN(3) should fail")
+	}
+	if !sem.TryAcquireN(2) {
+		t.Error("TryAcquireN(2) should succeed")
+	}
+	if err := sem.ReleaseN(5); err != nil {
+		t.Fatal(err)
+	}
+	if err := sem.ReleaseN(1); err != ErrIllegalRelease {
+		t.Errorf("expected ErrIllegalRelease, got %v", err)
+	}
+	if err := sem.AcquireN(ctx, -1); err != ErrInvalidCount {
+		t.Errorf("expected ErrInvalidCount, got %v", err)
+	}
+}
+
+// TestAcquireNContext 测试 ctx 结束时放弃等待
+func TestAcquireNContext(t *testing.T) {
+	sem := NewSemaphore(1, time.Second)
+	_ = sem.Acquire()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := sem.AcquireN(ctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+
+	// 超过容量的请求只会等到 ctx 结束
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel2()
+	if err := sem.AcquireN(ctx2, 2); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+
+	// 放弃的等待者不会占用许可
+	_ = sem.Release()
+	if !sem.TryAcquireN(1) {
+		t.Error("ticket should be available after release")
+	}
+}
+
+// TestAcquireNFIFO 测试大请求不会被源源不断的小请求饿死
+func TestAcquireNFIFO(t *testing.T) {
+	sem := NewSemaphore(4, time.Second)
+	ctx := context.Background()
+	_ = sem.AcquireN(ctx, 3)
+
+	big := make(chan struct{})
+	go func() {
+		_ = sem.AcquireN(ctx, 4)
+		close(big)
+	}()
+	for !waiting(sem, 1) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 还剩 1 个许可，但是大请求在排队，小请求也得排在后面
+	if sem.TryAcquireN(1) {
+		t.Fatal("TryAcquireN should not jump the queue")
+	}
+	small := make(chan struct{})
+	go func() {
+		_ = sem.AcquireN(ctx, 1)
+		close(small)
+	}()
+	for !waiting(sem, 2) {
+		time.Sleep(time.Millisecond)
+	}
+
+	_ = sem.ReleaseN(3)
+	select {
+	case <-big:
+	case <-time.After(time.Second):
+		t.Fatal("big request should be served first")
+	}
+	select {
+	case <-small:
+		t.Fatal("small request should wait for the big one to release")
+	default:
+	}
+	_ = sem.ReleaseN(4)
+	<-small
+}
+
+// TestAcquireNCancelFront 测试队首放弃后，后面的等待者被唤醒
+func TestAcquireNCancelFront(t *testing.T) {
+	sem := NewSemaphore(2, time.Second)
+	_ = sem.AcquireN(context.Background(), 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bigErr := make(chan error)
+	go func() { bigErr <- sem.AcquireN(ctx, 2) }()
+	for !waiting(sem, 1) {
+		time.Sleep(time.Millisecond)
+	}
+	small := make(chan error)
+	go func() { small <- sem.AcquireN(context.Background(), 1) }()
+	for !waiting(sem, 2) {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-bigErr; err != context.Canceled {
+		t.Errorf("expected Canceled, got %v", err)
+	}
+	select {
+	case err := <-small:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("small request should get the free ticket")
+	}
+}
+
+func waiting(s *Semaphore, n int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.waiters.Len() == n
+}
@@ -0,0 +1,56 @@
+package semaphore
+
+import "time"
+
+// 滑动窗口日志：记录每个名额的时间，任意长度为 window 的时间段内最多 limit 个
+type slidingWindow struct {
+	limit  int
+	window time.Duration
+	log    []time.Time // 按时间升序，可能包含未来的预约
+}
+
+func NewSlidingWindow(limit int, window time.Duration, opts ...LimiterOption) Limiter {
+	return newRateLimiter(&slidingWindow{limit: limit, window: window}, opts)
+}
+
+// 丢掉已经滑出窗口的记录
+func (sw *slidingWindow) prune(now time.Time) {
+	cutoff := now.Add(-sw.window)
+	i := 0
+	for i < len(sw.log) && !sw.log[i].After(cutoff) {
+		i++
+	}
+	sw.log = sw.log[i:]
+}
+
+func (sw *slidingWindow) reserve(now time.Time) (time.Time, bool) {
+	if sw.limit < 1 {
+		return time.Time{}, false
+	}
+	sw.prune(now)
+	at := now
+	if n := len(sw.log); n >= sw.limit {
+		// 倒数第 limit 个名额滑出窗口时才轮到这个请求
+		at = sw.log[n-sw.limit].Add(sw.window)
+	}
+	sw.log = append(sw.log, at)
+	return at, true
+}
+
+func (sw *slidingWindow) allow(now time.Time) bool {
+	sw.prune(now)
+	if len(sw.log) >= sw.limit {
+		return false
+	}
+	sw.log = append(sw.log, now)
+	return true
+}
+
+func (sw *slidingWindow) cancel(at, now time.Time) {
+	for i := len(sw.log) - 1; i >= 0; i-- {
+		if sw.log[i].Equal(at) {
+			sw.log = append(sw.log[:i], sw.log[i+1:]...)
+			return
+		}
+	}
+}
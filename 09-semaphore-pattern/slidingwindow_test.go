@@ -0,0 +1,44 @@
+package semaphore
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSlidingWindow 测试任意窗口内最多 limit 个，没有固定窗口边界的突刺
+func TestSlidingWindow(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	l := NewSlidingWindow(3, time.Second, WithClock(clock))
+	l.Allow()
+	clock.Advance(600 * time.Millisecond)
+	l.Allow()
+	l.Allow()
+	if l.Allow() {
+		t.Fatal("window should be full")
+	}
+
+	// 固定窗口在 1s 处会清零，滑动窗口只放出第一个
+	clock.Advance(400 * time.Millisecond)
+	if !l.Allow() {
+		t.Error("oldest entry should have left the window")
+	}
+	if l.Allow() {
+		t.Error("the other two entries are still in the window")
+	}
+}
+
+// TestSlidingWindowReserve 测试预约在最早的记录滑出窗口时执行
+func TestSlidingWindowReserve(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	l := NewSlidingWindow(2, time.Second, WithClock(clock))
+	l.Allow()
+	clock.Advance(300 * time.Millisecond)
+	l.Allow()
+
+	want := []time.Duration{700 * time.Millisecond, time.Second, 1700 * time.Millisecond}
+	for i, w := range want {
+		if d := l.Reserve().Delay(); d != w {
+			t.Errorf("reservation %d: expected %v, got %v", i, w, d)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package semaphore
+
+import "time"
+
+// 令牌桶：每秒放入 rate 个令牌，最多存 burst 个
+// 预约时令牌可以被透支成负数，透支的部分就是需要等待的时间，这样排队的请求也是先来先得
+type tokenBucket struct {
+	rate   float64 // 每秒放入的令牌数
+	burst  float64
+	tokens float64
+	last   time.Time // 上次计算令牌的时间
+}
+
+func NewTokenBucket(rate float64, burst int, opts ...LimiterOption) Limiter {
+	tb := &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+	l := newRateLimiter(tb, opts)
+	tb.last = l.clock.Now()
+	return l
+}
+
+// 按流逝的时间补充令牌
+func (tb *tokenBucket) advance(now time.Time) {
+	if elapsed := now.Sub(tb.last); elapsed > 0 {
+		tb.tokens += elapsed.Seconds() * tb.rate
+		if tb.tokens > tb.burst {
+			tb.tokens = tb.burst
+		}
+		tb.last = now
+	}
+}
+
+func (tb *tokenBucket) reserve(now time.Time) (time.Time, bool) {
+	tb.advance(now)
+	if tb.burst < 1 || (tb.rate <= 0 && tb.tokens < 1) {
+		return time.Time{}, false
+	}
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return now, true
+	}
+	wait := time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+	return now.Add(wait), true
+}
+
+func (tb *tokenBucket) allow(now time.Time) bool {
+	tb.advance(now)
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+func (tb *tokenBucket) cancel(at, now time.Time) {
+	tb.advance(now)
+	tb.tokens++
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+}
@@ -0,0 +1,52 @@
+package semaphore
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTokenBucketBurst 测试令牌桶允许 burst 个突发，之后按速率恢复
+func TestTokenBucketBurst(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	l := NewTokenBucket(2, 3, WithClock(clock))
+	for i := 0; i < 3; i++ {
+		if !l.Allow() {
+			t.Fatalf("call %d should be within burst", i)
+		}
+	}
+	if l.Allow() {
+		t.Fatal("bucket should be empty")
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if !l.Allow() {
+		t.Error("one token should be refilled after 500ms")
+	}
+	if l.Allow() {
+		t.Error("only one token should be refilled")
+	}
+
+	// 长时间空闲后最多攒 burst 个
+	clock.Advance(time.Hour)
+	n := 0
+	for l.Allow() {
+		n++
+	}
+	if n != 3 {
+		t.Errorf("expected burst of 3 after idle, got %d", n)
+	}
+}
+
+// TestTokenBucketQueue 测试排队的预约依次错开
+func TestTokenBucketQueue(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	l := NewTokenBucket(4, 1, WithClock(clock))
+	for i, want := range []time.Duration{0, 250 * time.Millisecond, 500 * time.Millisecond} {
+		if d := l.Reserve().Delay(); d != want {
+			t.Errorf("reservation %d: expected %v, got %v", i, want, d)
+		}
+	}
+	if l.Allow() {
+		t.Error("allow should not jump ahead of reservations")
+	}
+}
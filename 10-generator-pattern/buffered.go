@@ -0,0 +1,218 @@
+package generator
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+带预取和背压的生成器
+设计思想：
+
+	Count 用的是无缓冲 chan，生产者和消费者一步一停，谁慢另一个就得等着
+	1.Prefetch 在两者之间加一个 size 大小的缓冲，生产者可以提前生成 size 个值
+	2.生产者很贵(翻页读文件、调接口)时，缓冲区一有空位就去取一次并不划算，
+	  Buffered 用高低水位控制：缓冲区攒到 Size(高水位)时暂停生产，消费者把它读到 LowWatermark(低水位)以下才恢复，
+	  这样生产者总是一次连续地取一批，而不是零零碎碎地被唤醒
+	3.Buffered 记录生产者等待空位的时间和消费者等待数据的时间：
+	  生产者等得多说明消费者是瓶颈，缓冲区再大也没用；消费者等得多说明生产者太慢，应该加大预取或并发
+	Buffered 是拉取式的(实现了 Iterator)，这样才能测出消费者的等待时间，需要 chan 时用 ToChan 转换
+*/
+
+// 在 in 和返回的 chan 之间加 size 大小的缓冲
+func Prefetch[T any](ctx context.Context, in <-chan T, size int) <-chan T {
+	out := make(chan T, size)
+	go func() {
+		defer close(out)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok || !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// 生产一个值，没有更多值时返回 false
+type Producer[T any] func(ctx context.Context) (T, bool, error)
+
+// LowWatermark 取这个值时缓冲区读空了才恢复生产，生产者总是一次补满整个缓冲区
+const DrainLowWatermark = -1
+
+// Buffered 的选项
+type BufferOptions struct {
+	Size int // 缓冲区大小，也是高水位，默认 1
+	// 暂停后缓冲区降到不超过这个数量才恢复生产，默认(0)为 Size-1，即有空位就生产，
+	// 不小于 Size 时也按 Size-1 处理，读空才恢复用 DrainLowWatermark
+	LowWatermark int
+}
+
+// 生产者和消费者的统计
+type BufferStats struct {
+	Produced      uint64
+	Consumed      uint64
+	Buffered      int
+	Pauses        uint64        // 生产者因为缓冲区满而暂停的次数
+	ProducerStall time.Duration // 生产者等待空位的总时长
+	ConsumerStall time.Duration // 消费者等待数据的总时长
+}
+
+type Buffered[T any] struct {
+	opts   BufferOptions
+	ctx    context.Context
+	cancel context.CancelFunc
+	space  chan struct{} // 缓冲区降到低水位以下时通知生产者
+	data   chan struct{} // 有新数据或生产结束时通知消费者
+	done   chan struct{} // 生产者协程退出后关闭
+
+	mu       sync.Mutex
+	queue    []T
+	finished bool
+	err      error
+	stats    BufferStats
+}
+
+var _ Iterator[int] = (*Buffered[int])(nil)
+
+// 开一个协程调用 produce 预先生成值，直到它返回 false、出错或者 ctx 结束
+func NewBuffered[T any](ctx context.Context, produce Producer[T], opts BufferOptions) *Buffered[T] {
+	if opts.Size < 1 {
+		opts.Size = 1
+	}
+	switch {
+	case opts.LowWatermark < 0:
+		opts.LowWatermark = 0
+	case opts.LowWatermark == 0 || opts.LowWatermark >= opts.Size:
+		opts.LowWatermark = opts.Size - 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	b := &Buffered[T]{
+		opts:   opts,
+		ctx:    ctx,
+		cancel: cancel,
+		space:  make(chan struct{}, 1),
+		data:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		queue:  make([]T, 0, opts.Size),
+	}
+	go b.produce(produce)
+	return b
+}
+
+// 从迭代器预先取值
+func BufferIter[T any](ctx context.Context, it Iterator[T], opts BufferOptions) *Buffered[T] {
+	return NewBuffered(ctx, func(context.Context) (T, bool, error) {
+		v, ok := it.Next()
+		return v, ok, nil
+	}, opts)
+}
+
+func (b *Buffered[T]) produce(produce Producer[T]) {
+	defer close(b.done)
+	for {
+		if err := b.ctx.Err(); err != nil {
+			b.finish(err)
+			return
+		}
+		b.mu.Lock()
+		if len(b.queue) >= b.opts.Size {
+			b.stats.Pauses++
+			start := time.Now()
+			for len(b.queue) > b.opts.LowWatermark {
+				b.mu.Unlock()
+				select {
+				case <-b.space:
+				case <-b.ctx.Done():
+					b.finish(b.ctx.Err())
+					return
+				}
+				b.mu.Lock()
+			}
+			b.stats.ProducerStall += time.Since(start)
+		}
+		b.mu.Unlock()
+
+		v, ok, err := produce(b.ctx)
+		if err != nil || !ok {
+			b.finish(err)
+			return
+		}
+		b.mu.Lock()
+		b.queue = append(b.queue, v)
+		b.stats.Produced++
+		b.mu.Unlock()
+		signal(b.data)
+	}
+}
+
+// 生产结束，err 为 nil 表示正常结束
+func (b *Buffered[T]) finish(err error) {
+	b.mu.Lock()
+	b.finished = true
+	if b.err == nil {
+		b.err = err
+	}
+	b.mu.Unlock()
+	signal(b.data)
+}
+
+// 取下一个值，缓冲区为空时等待生产者，生产结束或出错后返回 false
+func (b *Buffered[T]) Next() (T, bool) {
+	var zero T
+	b.mu.Lock()
+	if len(b.queue) == 0 && !b.finished {
+		start := time.Now()
+		for len(b.queue) == 0 && !b.finished {
+			b.mu.Unlock()
+			<-b.data
+			b.mu.Lock()
+		}
+		b.stats.ConsumerStall += time.Since(start)
+	}
+	if len(b.queue) == 0 {
+		b.mu.Unlock()
+		return zero, false
+	}
+	v := b.queue[0]
+	b.queue[0] = zero
+	b.queue = b.queue[1:]
+	b.stats.Consumed++
+	wake := len(b.queue) <= b.opts.LowWatermark
+	b.mu.Unlock()
+	if wake {
+		signal(b.space)
+	}
+	return v, true
+}
+
+// 生产者的错误，正常结束或尚未结束时为 nil，Close 之后为 context.Canceled
+func (b *Buffered[T]) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// 统计信息
+func (b *Buffered[T]) Stats() BufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.stats
+	st.Buffered = len(b.queue)
+	return st
+}
+
+// 停止生产并等待生产者协程退出，缓冲区中剩下的值仍然可以读出
+func (b *Buffered[T]) Close() {
+	b.cancel()
+	<-b.done
+}
+
+// 非阻塞地通知一次
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
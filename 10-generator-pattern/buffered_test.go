@@ -0,0 +1,185 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestPrefetch 测试生产者可以提前生成 size 个值
+func TestPrefetch(t *testing.T) {
+	defer checkLeaks(t)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := Prefetch(ctx, CountContext(ctx, 1, 10), 4)
+	waitUntil(t, func() bool { return len(out) == 4 })
+	if got := fmt.Sprint(collect(out)); got != "[1 2 3 4 5 6 7 8 9 10]" {
+		t.Errorf("unexpected values %s", got)
+	}
+}
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// 模拟翻页读取的生产者，每次读取耗时 delay
+type pager struct {
+	mu    sync.Mutex
+	next  int
+	limit int
+	delay time.Duration
+}
+
+func (p *pager) produce(ctx context.Context) (int, bool, error) {
+	time.Sleep(p.delay)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.next >= p.limit {
+		return 0, false, nil
+	}
+	p.next++
+	return p.next, true, nil
+}
+
+func (p *pager) produced() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.next
+}
+
+// TestBufferedWatermarks 测试缓冲区满时暂停，降到低水位以下才恢复
+func TestBufferedWatermarks(t *testing.T) {
+	defer checkLeaks(t)()
+	p := &pager{limit: 100}
+	b := NewBuffered(context.Background(), p.produce, BufferOptions{Size: 8, LowWatermark: 2})
+	defer b.Close()
+
+	waitUntil(t, func() bool { return b.Stats().Pauses == 1 })
+	if p.produced() != 8 {
+		t.Fatalf("producer should stop at the high watermark, produced %d", p.produced())
+	}
+	for i := 1; i <= 5; i++ {
+		if v, _ := b.Next(); v != i {
+			t.Fatalf("expected %d, got %d", i, v)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	if p.produced() != 8 {
+		t.Errorf("producer should stay paused above the low watermark, produced %d", p.produced())
+	}
+	b.Next() // 剩 2 个，到达低水位
+	waitUntil(t, func() bool { return b.Stats().Pauses == 2 })
+	if p.produced() != 14 {
+		t.Errorf("producer should refill to the high watermark, produced %d", p.produced())
+	}
+
+	rest := Drain[int](b)
+	if len(rest) != 94 || rest[0] != 7 || b.Err() != nil {
+		t.Errorf("unexpected tail: %d values, err %v", len(rest), b.Err())
+	}
+	if st := b.Stats(); st.Produced != 100 || st.Consumed != 100 || st.Buffered != 0 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
+
+// TestBufferedDrainLowWatermark 测试 DrainLowWatermark 读空才恢复，默认有空位就恢复
+func TestBufferedDrainLowWatermark(t *testing.T) {
+	defer checkLeaks(t)()
+	p := &pager{limit: 100}
+	b := NewBuffered(context.Background(), p.produce, BufferOptions{Size: 4, LowWatermark: DrainLowWatermark})
+	defer b.Close()
+
+	waitUntil(t, func() bool { return b.Stats().Pauses == 1 })
+	for i := 1; i <= 3; i++ {
+		b.Next()
+	}
+	time.Sleep(5 * time.Millisecond)
+	if p.produced() != 4 {
+		t.Errorf("producer should stay paused until drained, produced %d", p.produced())
+	}
+	b.Next()
+	waitUntil(t, func() bool { return b.Stats().Pauses == 2 })
+	if p.produced() != 8 {
+		t.Errorf("producer should refill after drain, produced %d", p.produced())
+	}
+
+	q := &pager{limit: 100}
+	d := NewBuffered(context.Background(), q.produce, BufferOptions{Size: 4})
+	defer d.Close()
+	waitUntil(t, func() bool { return d.Stats().Pauses == 1 })
+	d.Next()
+	waitUntil(t, func() bool { return d.Stats().Pauses == 2 })
+	if q.produced() != 5 {
+		t.Errorf("default low watermark should refill one slot at a time, produced %d", q.produced())
+	}
+}
+
+// TestBufferedStall 测试分别记录生产者和消费者的等待时间
+func TestBufferedStall(t *testing.T) {
+	defer checkLeaks(t)()
+
+	// 生产者慢：消费者在等
+	slow := &pager{limit: 5, delay: 5 * time.Millisecond}
+	b := NewBuffered(context.Background(), slow.produce, BufferOptions{Size: 4})
+	Drain[int](b)
+	st := b.Stats()
+	if st.ConsumerStall < 15*time.Millisecond || st.ProducerStall > st.ConsumerStall {
+		t.Errorf("consumer should be the one waiting: %+v", st)
+	}
+
+	// 消费者慢：生产者在等
+	fast := &pager{limit: 10}
+	b = NewBuffered(context.Background(), fast.produce, BufferOptions{Size: 2})
+	for _, ok := b.Next(); ok; _, ok = b.Next() {
+		time.Sleep(3 * time.Millisecond)
+	}
+	st = b.Stats()
+	if st.ProducerStall < 15*time.Millisecond || st.ConsumerStall > st.ProducerStall {
+		t.Errorf("producer should be the one waiting: %+v", st)
+	}
+}
+
+// TestBufferedError 测试生产者出错后先读完缓冲区再结束
+func TestBufferedError(t *testing.T) {
+	defer checkLeaks(t)()
+	errPage := errors.New("page failed")
+	n := 0
+	b := NewBuffered(context.Background(), func(ctx context.Context) (int, bool, error) {
+		if n == 3 {
+			return 0, false, errPage
+		}
+		n++
+		return n, true, nil
+	}, BufferOptions{Size: 10})
+
+	if got := fmt.Sprint(Drain[int](b)); got != "[1 2 3]" {
+		t.Errorf("buffered values should be delivered before the error, got %s", got)
+	}
+	if b.Err() != errPage {
+		t.Errorf("expected errPage, got %v", b.Err())
+	}
+}
+
+// TestBufferedClose 测试 Close 让暂停中的生产者退出
+func TestBufferedClose(t *testing.T) {
+	defer checkLeaks(t)()
+	b := BufferIter(context.Background(), CountIter(1, 1000), BufferOptions{Size: 3})
+	waitUntil(t, func() bool { return b.Stats().Pauses == 1 })
+	b.Close()
+	if b.Err() != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", b.Err())
+	}
+	if got := len(Drain[int](b)); got != 3 {
+		t.Errorf("buffered values should remain readable, got %d", got)
+	}
+}
@@ -1,5 +1,7 @@
 package generator
 
+import "context"
+
 /* ============== 理论 ============== */
 // 生成器模式，略使用了go的channel个并发特性，相当于实现其他语言的yield功能
 //
@@ -11,6 +13,10 @@ package generator
 	设计思想：
 		函数返回一个只读的 <-chan
 		在函数内部开一个goruntine并发生成值放入chan中
+
+	Count 的协程只有把值发完才会退出，消费者中途不读了，协程就永远阻塞在发送上
+	带 ctx 的生成器在每次发送时同时等待 ctx，ctx 结束后协程退出并关闭 chan
+	消费者提前结束时 cancel 掉 ctx，整条链上的协程都会退出(操作符见 operators.go)
 */
 
 func Count(start, end int) <-chan int {
@@ -25,3 +31,63 @@ func Count(start, end int) <-chan int {
 
 	return ch
 }
+
+// 可以取消的 Count，ctx 结束时停止生成并关闭 chan
+func CountContext(ctx context.Context, start, end int) <-chan int {
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for i := start; i <= end; i++ {
+			if !send(ctx, ch, i) {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// 依次生成 vs 中的值
+func FromSlice[T any](ctx context.Context, vs ...T) <-chan T {
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		for _, v := range vs {
+			if !send(ctx, ch, v) {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// 不断调用 fn 生成值，直到 ctx 结束
+func Repeat[T any](ctx context.Context, fn func() T) <-chan T {
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		for send(ctx, ch, fn()) {
+		}
+	}()
+	return ch
+}
+
+// 发送一个值，ctx 先结束时返回 false
+func send[T any](ctx context.Context, ch chan<- T, v T) bool {
+	select {
+	case ch <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// 接收一个值，chan 关闭或 ctx 先结束时返回 false
+func recv[T any](ctx context.Context, ch <-chan T) (T, bool) {
+	select {
+	case v, ok := <-ch:
+		return v, ok
+	case <-ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
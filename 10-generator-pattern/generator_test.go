@@ -1,8 +1,11 @@
 package generator
 
 import (
+	"context"
 	"fmt"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestCount(t *testing.T) {
@@ -13,3 +16,60 @@ func TestCount(t *testing.T) {
 		fmt.Println(i)
 	}
 }
+
+// 测试结束时协程数回到开始时的水平
+func checkLeaks(t *testing.T) func() {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	return func() {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				t.Errorf("goroutine leak: %d before, %d after", before, runtime.NumGoroutine())
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func collect[T any](ch <-chan T) []T {
+	var vs []T
+	for v := range ch {
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+// TestCountContext 测试消费者提前结束时，cancel 后生成器协程退出
+func TestCountContext(t *testing.T) {
+	defer checkLeaks(t)()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := CountContext(ctx, 1, 1000)
+	for i := 1; i <= 3; i++ {
+		if v := <-ch; v != i {
+			t.Fatalf("expected %d, got %d", i, v)
+		}
+	}
+	cancel()
+	for range ch {
+	}
+
+	if got := collect(CountContext(context.Background(), 1, 5)); fmt.Sprint(got) != "[1 2 3 4 5]" {
+		t.Errorf("unexpected values %v", got)
+	}
+}
+
+// TestRepeat 测试无限生成器在 cancel 后退出
+func TestRepeat(t *testing.T) {
+	defer checkLeaks(t)()
+	ctx, cancel := context.WithCancel(context.Background())
+	n := 0
+	ch := Repeat(ctx, func() int { n++; return n })
+	<-ch
+	<-ch
+	cancel()
+	for range ch {
+	}
+}
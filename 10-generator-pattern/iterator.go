@@ -0,0 +1,85 @@
+package generator
+
+import "context"
+
+/*
+拉取式迭代器
+设计思想：
+
+	chan 生成器每个值都要经过一次 chan 的交接，还要多开一个协程，热循环里这部分开销比生成值本身大得多
+	Iterator 换成由消费者主动拉取：调用 Next 时才计算下一个值，整个过程在调用方的协程里同步完成
+	1.同步的生产者(计数、遍历切片)直接写成 IteratorFunc，不需要协程也不需要 chan
+	2.FromChan 把已有的 chan 生成器包装成迭代器，ToChan 把迭代器变回 chan，
+	  两种形式可以随时互相转换，用在需要 select、多个消费者的地方
+	3.迭代器不是并发安全的，同一时间只能有一个协程调用 Next
+	每个值的开销对比见 iterator_test.go 中的基准测试
+*/
+
+// 拉取式迭代器，没有更多值时返回 false
+type Iterator[T any] interface {
+	Next() (T, bool)
+}
+
+// 用函数实现的迭代器
+type IteratorFunc[T any] func() (T, bool)
+
+func (f IteratorFunc[T]) Next() (T, bool) {
+	return f()
+}
+
+// Count 的迭代器版本，不需要协程
+func CountIter(start, end int) Iterator[int] {
+	i := start
+	return IteratorFunc[int](func() (int, bool) {
+		if i > end {
+			return 0, false
+		}
+		i++
+		return i - 1, true
+	})
+}
+
+// 依次返回 vs 中的值
+func SliceIter[T any](vs ...T) Iterator[T] {
+	i := 0
+	return IteratorFunc[T](func() (T, bool) {
+		if i >= len(vs) {
+			var zero T
+			return zero, false
+		}
+		i++
+		return vs[i-1], true
+	})
+}
+
+// 把 chan 包装成迭代器，chan 关闭时结束
+func FromChan[T any](ch <-chan T) Iterator[T] {
+	return IteratorFunc[T](func() (T, bool) {
+		v, ok := <-ch
+		return v, ok
+	})
+}
+
+// 开一个协程把迭代器的值发到 chan，迭代器结束或 ctx 结束时关闭 chan
+func ToChan[T any](ctx context.Context, it Iterator[T]) <-chan T {
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		for {
+			v, ok := it.Next()
+			if !ok || !send(ctx, ch, v) {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// 取出迭代器剩下的所有值
+func Drain[T any](it Iterator[T]) []T {
+	var vs []T
+	for v, ok := it.Next(); ok; v, ok = it.Next() {
+		vs = append(vs, v)
+	}
+	return vs
+}
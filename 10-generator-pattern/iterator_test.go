@@ -0,0 +1,114 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// TestIterators 测试迭代器以及与 chan 之间的转换
+func TestIterators(t *testing.T) {
+	defer checkLeaks(t)()
+	if got := fmt.Sprint(Drain(CountIter(1, 5))); got != "[1 2 3 4 5]" {
+		t.Errorf("unexpected CountIter %s", got)
+	}
+	if got := Drain(CountIter(5, 1)); len(got) != 0 {
+		t.Errorf("empty range should yield nothing, got %v", got)
+	}
+	if got := fmt.Sprint(Drain(SliceIter("a", "b"))); got != "[a b]" {
+		t.Errorf("unexpected SliceIter %s", got)
+	}
+
+	ctx := context.Background()
+	if got := fmt.Sprint(Drain(FromChan(CountContext(ctx, 1, 3)))); got != "[1 2 3]" {
+		t.Errorf("unexpected FromChan %s", got)
+	}
+	// 转成 chan 后可以继续使用操作符
+	if got := fmt.Sprint(collect(Map(ctx, ToChan(ctx, CountIter(1, 3)), func(v int) int { return v * 10 }))); got != "[10 20 30]" {
+		t.Errorf("unexpected ToChan %s", got)
+	}
+
+	it := CountIter(1, 2)
+	it.Next()
+	it.Next()
+	if _, ok := it.Next(); ok {
+		t.Error("exhausted iterator should stay exhausted")
+	}
+}
+
+// TestToChanCancel 测试 ToChan 的协程在 ctx 结束后退出
+func TestToChanCancel(t *testing.T) {
+	defer checkLeaks(t)()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := ToChan(ctx, CountIter(1, 1<<30))
+	<-ch
+	cancel()
+	for range ch {
+	}
+}
+
+/*
+每个值的开销，b.N 是生成的值的个数
+	go test -run xxx -bench Gen -benchmem ./10-generator-pattern/
+
+	一次运行的结果(数字随机器变化)：
+		Loop          ~0.7ns  普通 for 循环，作为基准线
+		CountIter     ~3ns    迭代器，一次函数调用
+		Count         ~430ns  chan 生成器，每个值一次协程切换
+		CountContext  ~500ns  多了一个 select
+		FromChan      ~450ns  包装 chan 不能省掉交接的开销
+		ToChan        ~510ns  迭代器变回 chan 后开销又回来了
+	同步的生产者改用迭代器能快两个数量级，chan 只在真正需要并发时使用
+*/
+
+var sink int
+
+func BenchmarkGenLoop(b *testing.B) {
+	sum := 0
+	for i := 0; i < b.N; i++ {
+		sum += i
+	}
+	sink = sum
+}
+
+func BenchmarkGenCountIter(b *testing.B) {
+	sum := 0
+	it := CountIter(0, b.N-1)
+	for v, ok := it.Next(); ok; v, ok = it.Next() {
+		sum += v
+	}
+	sink = sum
+}
+
+func BenchmarkGenCount(b *testing.B) {
+	sum := 0
+	for v := range Count(0, b.N-1) {
+		sum += v
+	}
+	sink = sum
+}
+
+func BenchmarkGenCountContext(b *testing.B) {
+	sum := 0
+	for v := range CountContext(context.Background(), 0, b.N-1) {
+		sum += v
+	}
+	sink = sum
+}
+
+func BenchmarkGenFromChan(b *testing.B) {
+	sum := 0
+	it := FromChan(Count(0, b.N-1))
+	for v, ok := it.Next(); ok; v, ok = it.Next() {
+		sum += v
+	}
+	sink = sum
+}
+
+func BenchmarkGenToChan(b *testing.B) {
+	sum := 0
+	for v := range ToChan(context.Background(), CountIter(0, b.N-1)) {
+		sum += v
+	}
+	sink = sum
+}
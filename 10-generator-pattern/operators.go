@@ -0,0 +1,242 @@
+package generator
+
+import (
+	"context"
+	"sync"
+)
+
+/*
+流操作符
+设计思想：
+
+	每个操作符接收一个 <-chan，返回一个新的 <-chan，可以像管道一样组合：
+		Take(ctx, Map(ctx, Filter(ctx, CountContext(ctx, 1, 100), isEven), square), 5)
+	1.每个操作符开一个协程，输入关闭时关闭输出
+	2.收发都同时等待 ctx，ctx 结束时协程立即退出并关闭输出，不会泄漏
+	3.Take 取够之后就不再读上游，上游会阻塞到 ctx 结束，所以整条链用完后要 cancel 掉 ctx
+	输出都是无缓冲的，下游不读时整条链自然停下来
+*/
+
+// 对每个值调用 fn
+func Map[T, R any](ctx context.Context, in <-chan T, fn func(T) R) <-chan R {
+	out := make(chan R)
+	go func() {
+		defer close(out)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok || !send(ctx, out, fn(v)) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// 只保留 fn 返回 true 的值
+func Filter[T any](ctx context.Context, in <-chan T, fn func(T) bool) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return
+			}
+			if fn(v) && !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// 只取前 n 个
+func Take[T any](ctx context.Context, in <-chan T, n int) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for i := 0; i < n; i++ {
+			v, ok := recv(ctx, in)
+			if !ok || !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// 跳过前 n 个
+func Skip[T any](ctx context.Context, in <-chan T, n int) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for i := 0; ; i++ {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return
+			}
+			if i >= n && !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// 每 size 个值打成一批，最后一批可能不满
+func Batch[T any](ctx context.Context, in <-chan T, size int) <-chan []T {
+	out := make(chan []T)
+	go func() {
+		defer close(out)
+		if size < 1 {
+			size = 1
+		}
+		batch := make([]T, 0, size)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				if len(batch) > 0 && ctx.Err() == nil {
+					send(ctx, out, batch)
+				}
+				return
+			}
+			if batch = append(batch, v); len(batch) == size {
+				if !send(ctx, out, batch) {
+					return
+				}
+				batch = make([]T, 0, size)
+			}
+		}
+	}()
+	return out
+}
+
+// 滑动窗口：攒够 size 个之后，每来一个值输出一次最近的 size 个
+func Window[T any](ctx context.Context, in <-chan T, size int) <-chan []T {
+	out := make(chan []T)
+	go func() {
+		defer close(out)
+		if size < 1 {
+			size = 1
+		}
+		window := make([]T, 0, size)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return
+			}
+			if len(window) == size {
+				window = window[1:]
+			}
+			window = append(window, v)
+			if len(window) == size {
+				// 每次输出一份拷贝，下游可以放心持有
+				w := make([]T, size)
+				copy(w, window)
+				if !send(ctx, out, w) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// 合并多个输入，输出顺序不确定，所有输入都关闭后关闭输出
+func Merge[T any](ctx context.Context, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+	var wg sync.WaitGroup
+	wg.Add(len(ins))
+	for _, in := range ins {
+		go func(in <-chan T) {
+			defer wg.Done()
+			for {
+				v, ok := recv(ctx, in)
+				if !ok || !send(ctx, out, v) {
+					return
+				}
+			}
+		}(in)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// 两个值组成的对
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+// 把两个输入按顺序一一配对，任意一个关闭时结束
+func Zip[A, B any](ctx context.Context, a <-chan A, b <-chan B) <-chan Pair[A, B] {
+	out := make(chan Pair[A, B])
+	go func() {
+		defer close(out)
+		for {
+			x, ok := recv(ctx, a)
+			if !ok {
+				return
+			}
+			y, ok := recv(ctx, b)
+			if !ok || !send(ctx, out, Pair[A, B]{First: x, Second: y}) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// 把一个输入复制成两个，每个值两边都发送之后才读下一个，所以两边都要读
+func Tee[T any](ctx context.Context, in <-chan T) (<-chan T, <-chan T) {
+	out1, out2 := make(chan T), make(chan T)
+	go func() {
+		defer close(out1)
+		defer close(out2)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return
+			}
+			// 发送过的一边置为 nil，不会再被选中
+			o1, o2 := out1, out2
+			for o1 != nil || o2 != nil {
+				select {
+				case o1 <- v:
+					o1 = nil
+				case o2 <- v:
+					o2 = nil
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out1, out2
+}
+
+// 去掉重复的值，已经见过的值都保存在内存里
+func Distinct[T comparable](ctx context.Context, in <-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		seen := make(map[T]struct{})
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return
+			}
+			if _, dup := seen[v]; dup {
+				continue
+			}
+			seen[v] = struct{}{}
+			if !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
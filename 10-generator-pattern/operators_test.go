@@ -0,0 +1,110 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// TestOperators 测试各个操作符的输出
+func TestOperators(t *testing.T) {
+	defer checkLeaks(t)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nums := func() <-chan int { return CountContext(ctx, 1, 10) }
+	isEven := func(v int) bool { return v%2 == 0 }
+	square := func(v int) int { return v * v }
+
+	cases := []struct {
+		name string
+		got  interface{}
+		want string
+	}{
+		{"Map", collect(Map(ctx, nums(), square)), "[1 4 9 16 25 36 49 64 81 100]"},
+		{"Filter", collect(Filter(ctx, nums(), isEven)), "[2 4 6 8 10]"},
+		{"Take", collect(Take(ctx, nums(), 3)), "[1 2 3]"},
+		{"Skip", collect(Skip(ctx, nums(), 7)), "[8 9 10]"},
+		{"Batch", collect(Batch(ctx, nums(), 4)), "[[1 2 3 4] [5 6 7 8] [9 10]]"},
+		{"Window", collect(Window(ctx, Take(ctx, nums(), 5), 3)), "[[1 2 3] [2 3 4] [3 4 5]]"},
+		{"Zip", collect(Zip(ctx, nums(), FromSlice(ctx, "a", "b"))), "[{1 a} {2 b}]"},
+		{"Distinct", collect(Distinct(ctx, FromSlice(ctx, 1, 2, 1, 3, 2))), "[1 2 3]"},
+		{"Compose", collect(Take(ctx, Map(ctx, Filter(ctx, nums(), isEven), square), 2)), "[4 16]"},
+	}
+	for _, c := range cases {
+		if got := fmt.Sprint(c.got); got != c.want {
+			t.Errorf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+	// Take 取够后上游还在等待，cancel 之后退出
+	cancel()
+}
+
+// TestMergeTee 测试合并和复制
+func TestMergeTee(t *testing.T) {
+	defer checkLeaks(t)()
+	ctx := context.Background()
+	merged := collect(Merge(ctx, FromSlice(ctx, 1, 2), FromSlice(ctx, 3), FromSlice(ctx, 4, 5)))
+	sort.Ints(merged)
+	if fmt.Sprint(merged) != "[1 2 3 4 5]" {
+		t.Errorf("unexpected merge %v", merged)
+	}
+
+	a, b := Tee(ctx, FromSlice(ctx, 1, 2, 3))
+	var got [2][]int
+	done := make(chan struct{})
+	go func() {
+		got[1] = collect(b)
+		close(done)
+	}()
+	got[0] = collect(a)
+	<-done
+	if fmt.Sprint(got) != "[[1 2 3] [1 2 3]]" {
+		t.Errorf("unexpected tee %v", got)
+	}
+}
+
+// TestOperatorsCancel 测试下游不读时 cancel 能让整条链上的协程退出
+func TestOperatorsCancel(t *testing.T) {
+	defer checkLeaks(t)()
+	ctx, cancel := context.WithCancel(context.Background())
+	nums := func() <-chan int { return Repeat(ctx, func() int { return 1 }) }
+
+	outs := []<-chan int{
+		Map(ctx, nums(), func(v int) int { return v }),
+		Filter(ctx, nums(), func(int) bool { return true }),
+		Take(ctx, nums(), 100),
+		Skip(ctx, nums(), 1),
+		Merge(ctx, nums(), nums()),
+		Distinct(ctx, Map(ctx, nums(), func(int) int { return 0 })), // 只会输出一个值，然后一直读上游
+	}
+	batches := []<-chan []int{Batch(ctx, nums(), 3), Window(ctx, nums(), 3)}
+	zipped := Zip(ctx, nums(), nums())
+	t1, t2 := Tee(ctx, nums())
+
+	for _, out := range outs {
+		<-out
+	}
+	for _, out := range batches {
+		<-out
+	}
+	<-zipped
+	<-t1 // t2 没人读，Tee 卡在发送上
+	_ = t2
+
+	cancel()
+	for _, out := range outs {
+		for range out {
+		}
+	}
+	for _, out := range batches {
+		for range out {
+		}
+	}
+	for range zipped {
+	}
+	for range t1 {
+	}
+	for range t2 {
+	}
+}
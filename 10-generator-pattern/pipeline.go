@@ -0,0 +1,256 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+/*
+并行流水线
+设计思想：
+
+	ETL 这类任务通常是几个阶段串起来：读取 -> 解析 -> 转换 -> 写入，每个阶段的耗时不同，需要的并发度也不同
+	Stage 把一个处理函数变成流水线上的一段：从上游 chan 读，开 Workers 个协程并发处理，结果写到下游 chan
+	1.NewPipeline 返回流水线和它的 ctx，源头的生成器要用这个 ctx，出错或 Stop 时整条流水线一起停下来
+	2.默认任意一个阶段出错就取消整条流水线，Wait 返回第一个错误(与 errgroup 相同)
+	3.ErrorChan 让某个阶段的错误发到单独的 chan，出错的值被丢掉，流水线继续运行
+	4.Ordered 让多个协程的输出保持输入的顺序：每个值带上序号，处理完后按序号重排，
+	  为了防止慢的值让重排缓冲区无限增长，最多允许 2*Workers 个值在途
+	消费者读完最后一个阶段的输出后调用 Wait；中途不读了要先调用 Stop，否则各阶段的协程会一直阻塞在发送上
+*/
+
+// 某个阶段处理失败
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("generator: stage %s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+type Pipeline struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	err    error
+	stages int
+}
+
+// 创建流水线，返回的 ctx 在出错或 Stop 时结束
+func NewPipeline(ctx context.Context) (*Pipeline, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Pipeline{ctx: ctx, cancel: cancel}
+	return p, ctx
+}
+
+// 记录第一个错误并取消流水线
+func (p *Pipeline) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+		p.cancel()
+	}
+}
+
+// 停止流水线，消费者提前结束时调用
+func (p *Pipeline) Stop() {
+	p.cancel()
+}
+
+// 等待所有阶段的协程退出，返回第一个错误
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	p.cancel()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *Pipeline) goroutine(fn func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		fn()
+	}()
+}
+
+type stageConfig struct {
+	name    string
+	workers int
+	ordered bool
+	errs    chan<- error
+}
+
+// 阶段选项
+type StageOption func(*stageConfig)
+
+// 并发处理的协程数，默认 1
+func Workers(n int) StageOption {
+	return func(c *stageConfig) {
+		c.workers = n
+	}
+}
+
+// 输出保持输入的顺序
+func Ordered() StageOption {
+	return func(c *stageConfig) {
+		c.ordered = true
+	}
+}
+
+// 阶段名，出现在 StageError 中，默认 stage-1、stage-2...
+func Name(name string) StageOption {
+	return func(c *stageConfig) {
+		c.name = name
+	}
+}
+
+// 这个阶段的错误发到 errs，出错的值被丢掉，不会取消流水线
+// errs 需要有人读，否则这个阶段会阻塞在发送错误上
+func ErrorChan(errs chan<- error) StageOption {
+	return func(c *stageConfig) {
+		c.errs = errs
+	}
+}
+
+// 流水线上的一段：用 fn 并发处理 in 中的每个值
+func Stage[T, R any](p *Pipeline, in <-chan T, fn func(ctx context.Context, v T) (R, error), opts ...StageOption) <-chan R {
+	p.mu.Lock()
+	p.stages++
+	cfg := stageConfig{name: fmt.Sprintf("stage-%d", p.stages), workers: 1}
+	p.mu.Unlock()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.workers < 1 {
+		cfg.workers = 1
+	}
+
+	// 处理一个值，出错时按配置上报，返回结果是否有效
+	process := func(v T) (R, bool) {
+		r, err := fn(p.ctx, v)
+		if err == nil {
+			return r, true
+		}
+		err = &StageError{Stage: cfg.name, Err: err}
+		if cfg.errs != nil {
+			send(p.ctx, cfg.errs, err)
+		} else {
+			p.fail(err)
+		}
+		return r, false
+	}
+
+	if cfg.ordered {
+		return orderedStage(p, in, cfg.workers, process)
+	}
+
+	out := make(chan R)
+	var wg sync.WaitGroup
+	wg.Add(cfg.workers)
+	for i := 0; i < cfg.workers; i++ {
+		p.goroutine(func() {
+			defer wg.Done()
+			for {
+				v, ok := recv(p.ctx, in)
+				if !ok {
+					return
+				}
+				if r, ok := process(v); ok && !send(p.ctx, out, r) {
+					return
+				}
+			}
+		})
+	}
+	p.goroutine(func() {
+		wg.Wait()
+		close(out)
+	})
+	return out
+}
+
+type seqItem[T any] struct {
+	seq int
+	v   T
+	ok  bool // 处理失败的值也要占住序号，否则后面的值永远等不到它
+}
+
+// 保持顺序的阶段：分发、处理、重排三步
+func orderedStage[T, R any](p *Pipeline, in <-chan T, workers int, process func(T) (R, bool)) <-chan R {
+	var (
+		out     = make(chan R)
+		jobs    = make(chan seqItem[T])
+		results = make(chan seqItem[R])
+		window  = make(chan struct{}, 2*workers) // 在途的值，重排输出后才释放
+	)
+
+	p.goroutine(func() {
+		defer close(jobs)
+		for seq := 0; ; seq++ {
+			if !send(p.ctx, window, struct{}{}) {
+				return
+			}
+			v, ok := recv(p.ctx, in)
+			if !ok || !send(p.ctx, jobs, seqItem[T]{seq: seq, v: v, ok: true}) {
+				return
+			}
+		}
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		p.goroutine(func() {
+			defer wg.Done()
+			for {
+				job, ok := recv(p.ctx, jobs)
+				if !ok {
+					return
+				}
+				r, ok := process(job.v)
+				if !send(p.ctx, results, seqItem[R]{seq: job.seq, v: r, ok: ok}) {
+					return
+				}
+			}
+		})
+	}
+	p.goroutine(func() {
+		wg.Wait()
+		close(results)
+	})
+
+	p.goroutine(func() {
+		defer close(out)
+		pending := make(map[int]seqItem[R])
+		next := 0
+		for {
+			r, ok := recv(p.ctx, results)
+			if !ok {
+				return
+			}
+			pending[r.seq] = r
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+				<-window
+				if r.ok && !send(p.ctx, out, r.v) {
+					return
+				}
+			}
+		}
+	})
+	return out
+}
@@ -0,0 +1,146 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 随机耗时，让多个协程的完成顺序打乱
+func jitter() {
+	time.Sleep(time.Duration(rand.Intn(300)) * time.Microsecond)
+}
+
+// TestPipeline 测试多个阶段并发处理，无序输出包含所有结果
+func TestPipeline(t *testing.T) {
+	defer checkLeaks(t)()
+	p, ctx := NewPipeline(context.Background())
+	var (
+		active int64
+		peak   int64
+	)
+	squares := Stage(p, CountContext(ctx, 1, 100), func(ctx context.Context, v int) (int, error) {
+		n := atomic.AddInt64(&active, 1)
+		for {
+			old := atomic.LoadInt64(&peak)
+			if n <= old || atomic.CompareAndSwapInt64(&peak, old, n) {
+				break
+			}
+		}
+		jitter()
+		atomic.AddInt64(&active, -1)
+		return v * v, nil
+	}, Workers(4))
+	strs := Stage(p, squares, func(ctx context.Context, v int) (string, error) {
+		return strconv.Itoa(v), nil
+	}, Workers(2))
+
+	got := collect(strs)
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 100 {
+		t.Fatalf("expected 100 results, got %d", len(got))
+	}
+	if peak > 4 {
+		t.Errorf("at most 4 workers should run at once, got %d", peak)
+	}
+	if peak < 2 {
+		t.Errorf("workers should run concurrently, peak %d", peak)
+	}
+}
+
+// TestPipelineOrdered 测试多个协程处理时输出仍然保持输入顺序
+func TestPipelineOrdered(t *testing.T) {
+	defer checkLeaks(t)()
+	p, ctx := NewPipeline(context.Background())
+	out := Stage(p, CountContext(ctx, 1, 200), func(ctx context.Context, v int) (int, error) {
+		jitter()
+		return v, nil
+	}, Workers(8), Ordered())
+
+	got := collect(out)
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 200 || !sort.IntsAreSorted(got) {
+		t.Errorf("output should keep input order: %v", got)
+	}
+}
+
+// TestPipelineFirstError 测试第一个错误取消整条流水线
+func TestPipelineFirstError(t *testing.T) {
+	defer checkLeaks(t)()
+	errBad := errors.New("bad value")
+	for _, ordered := range []bool{false, true} {
+		p, ctx := NewPipeline(context.Background())
+		opts := []StageOption{Workers(4), Name("check")}
+		if ordered {
+			opts = append(opts, Ordered())
+		}
+		out := Stage(p, Repeat(ctx, func() int { return rand.Intn(100) }), func(ctx context.Context, v int) (int, error) {
+			if v == 42 {
+				return 0, errBad
+			}
+			return v, nil
+		}, opts...)
+		out = Stage(p, out, func(ctx context.Context, v int) (int, error) { return v, nil })
+
+		for range out {
+		}
+		err := p.Wait()
+		var se *StageError
+		if !errors.As(err, &se) || se.Stage != "check" || !errors.Is(err, errBad) {
+			t.Errorf("ordered=%v: expected StageError from check, got %v", ordered, err)
+		}
+		if ctx.Err() == nil {
+			t.Error("pipeline context should be canceled")
+		}
+	}
+}
+
+// TestPipelineErrorChan 测试错误发到单独的 chan 时流水线继续运行
+func TestPipelineErrorChan(t *testing.T) {
+	defer checkLeaks(t)()
+	p, ctx := NewPipeline(context.Background())
+	errs := make(chan error, 100)
+	out := Stage(p, CountContext(ctx, 1, 20), func(ctx context.Context, v int) (int, error) {
+		if v%5 == 0 {
+			return 0, fmt.Errorf("multiple of five: %d", v)
+		}
+		return v, nil
+	}, Workers(3), Ordered(), ErrorChan(errs))
+
+	got := collect(out)
+	if err := p.Wait(); err != nil {
+		t.Fatalf("errors sent to the channel should not fail the pipeline: %v", err)
+	}
+	close(errs)
+	if len(got) != 16 || !sort.IntsAreSorted(got) {
+		t.Errorf("unexpected output %v", got)
+	}
+	if n := len(collect((<-chan error)(errs))); n != 4 {
+		t.Errorf("expected 4 stage errors, got %d", n)
+	}
+}
+
+// TestPipelineStop 测试消费者提前结束时 Stop 让所有协程退出
+func TestPipelineStop(t *testing.T) {
+	defer checkLeaks(t)()
+	p, ctx := NewPipeline(context.Background())
+	out := Stage(p, Repeat(ctx, func() int { return 1 }), func(ctx context.Context, v int) (int, error) {
+		return v, nil
+	}, Workers(4), Ordered())
+	<-out
+	<-out
+	p.Stop()
+	if err := p.Wait(); err != nil {
+		t.Errorf("stop is not an error, got %v", err)
+	}
+}
@@ -0,0 +1,388 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+/*
+至少一次投递：确认与重投
+设计思想：
+
+	普通订阅者只要消息进了chan就算投递成功，消费者处理到一半崩溃，消息就丢了
+	SubscribeAck 在一个普通订阅者外面再套一层，消费者收到的是 *Delivery：
+		1.每条消息分配一个 ID，交给消费者后进入"处理中"，并记下可见性超时的截止时间
+		2.消费者处理完调用 Ack，消息被删除；调用 Nack 或超时未确认，消息重新排队投递
+		3.一条消息投递满 MaxDeliveries 次仍未确认，就发布到死信主题 DeadLetter，不再重投
+		  死信只路由给订阅了死信主题的命名订阅者，不会发给过滤器订阅者，
+		  否则不带 WithPattern 的 SubscribeAck 会收到自己的死信，再次超时又包一层死信，无休无止
+	重投的消息优先于新消息，有消息等待重投时不再从内部订阅者取新消息，
+	积压会留在内部订阅者的队列里，仍然由溢出策略处理
+	可见性超时对所有消息相同，所以"处理中"的截止时间天然有序，用一个先进先出的时间线就能找到最早到期的消息
+	退订时尚未确认的消息直接丢弃
+
+	处理中的状态在交给消费者之前就记录好，消费者一拿到就可以 Nack，不会因为投递协程还没来得及记录而落空，
+	这次没交出去(超时、被唤醒)就撤销，不算一次投递
+	每次投递有自己的回执：重投交出去之后，上一次投递的 Ack/Nack 返回 ErrUnknownDelivery，
+	不会误确认或者误重投正在处理的那一次；重投还在排队时，上一次的 Ack 依然有效，排队的重投被取消
+*/
+var ErrUnknownDelivery = errors.New("pubsub: delivery already acked, redelivered or dead-lettered")
+
+const (
+	defaultVisibilityTimeout = 30 * time.Second
+	defaultMaxDeliveries     = 5
+)
+
+// 确认模式的选项
+type AckOptions struct {
+	VisibilityTimeout time.Duration // 交给消费者后多久未确认就重投，默认 30s
+	MaxDeliveries     int           // 最多投递次数，默认 5
+	DeadLetter        string        // 死信主题，为空时超过次数的消息直接丢弃
+}
+
+// 交给消费者的一次投递
+type Delivery struct {
+	ID      uint64      // 同一条消息的每次重投 ID 相同
+	Attempt int         // 第几次投递，从 1 开始
+	Value   interface{} // 消息内容
+	sub     *AckSubscription
+	receipt int // 投递时的次数，只有最近一次投递的回执有效
+}
+
+// 确认消息已经处理完
+func (d *Delivery) Ack() error {
+	return d.sub.settle(d.ID, d.receipt, false)
+}
+
+// 处理失败，消息立即重新排队
+func (d *Delivery) Nack() error {
+	return d.sub.settle(d.ID, d.receipt, true)
+}
+
+// 发布到死信主题的消息
+type DeadLetter struct {
+	ID         uint64
+	Deliveries int // 已经投递的次数
+	Value      interface{}
+}
+
+// 确认模式订阅者的统计信息
+type AckStats struct {
+	SubscriberStats        // 内部订阅者的统计
+	InFlight        int    // 已交给(或正在交给)消费者、尚未确认的条数
+	Redelivered     uint64 // 重投的次数
+	DeadLettered    uint64 // 进入死信的条数
+}
+
+// 一条需要确认的消息
+type ackMsg struct {
+	id       uint64
+	value    interface{}
+	attempts int       // 已经投递的次数
+	deadline time.Time // 处理中的截止时间，零值表示正在排队
+}
+
+// 时间线上的一项，attempts 与消息当前的不同说明已经过期
+type ackDeadline struct {
+	m        *ackMsg
+	attempts int
+}
+
+type AckSubscription struct {
+	C <-chan *Delivery
+
+	p    *Publisher
+	sub  *Subscription
+	opts AckOptions
+	out  chan *Delivery
+	wake chan struct{} // Ack、Nack 后唤醒投递协程
+	done chan struct{}
+
+	mu           sync.Mutex
+	nextID       uint64
+	msgs         map[uint64]*ackMsg // 排队中和处理中的消息
+	pending      []*ackMsg          // 等待投递，重投的在前
+	offered      *ackMsg            // 正在交给消费者、还不知道对方是否已经拿到的消息
+	timeline     []ackDeadline      // 处理中的消息，按截止时间排序
+	inFlight     int
+	redelivered  uint64
+	deadLettered uint64
+}
+
+// 添加一个确认模式的订阅者，ctx 结束时自动退订
+func (p *Publisher) SubscribeAck(ctx context.Context, ack AckOptions, opts ...SubscribeOption) (*AckSubscription, error) {
+	if ack.VisibilityTimeout <= 0 {
+		ack.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if ack.MaxDeliveries < 1 {
+		ack.MaxDeliveries = defaultMaxDeliveries
+	}
+	if ack.DeadLetter != "" {
+		if _, err := splitTopic(ack.DeadLetter, false); err != nil {
+			return nil, err
+		}
+	}
+
+	sub, err := p.SubscribeContext(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	a := &AckSubscription{
+		p:    p,
+		sub:  sub,
+		opts: ack,
+		out:  make(chan *Delivery),
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+		msgs: make(map[uint64]*ackMsg),
+	}
+	a.C = a.out
+	go a.run()
+	return a, nil
+}
+
+// 投递协程
+func (a *AckSubscription) run() {
+	defer close(a.done)
+	defer close(a.out)
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		a.mu.Lock()
+		dead := a.expireLocked(time.Now())
+		var (
+			send chan<- *Delivery
+			next *Delivery
+			in   <-chan interface{}
+		)
+		if len(a.pending) > 0 {
+			m := a.pending[0]
+			a.offerLocked(m)
+			send = a.out
+			next = &Delivery{ID: m.id, Attempt: m.attempts, Value: m.value, sub: a, receipt: m.attempts}
+		} else {
+			in = a.sub.C
+		}
+		var expire <-chan time.Time
+		if len(a.timeline) > 0 {
+			resetTimer(timer, time.Until(a.timeline[0].m.deadline))
+			expire = timer.C
+		}
+		a.mu.Unlock()
+
+		for _, m := range dead {
+			a.deadLetter(m)
+		}
+		if len(dead) > 0 {
+			a.withdraw()
+			continue
+		}
+
+		select {
+		case send <- next:
+			// 处理中的状态已经记录过了，之后上一次投递的回执失效
+			a.mu.Lock()
+			a.offered = nil
+			a.mu.Unlock()
+			continue
+		case v, ok := <-in:
+			if !ok {
+				return
+			}
+			a.mu.Lock()
+			a.nextID++
+			m := &ackMsg{id: a.nextID, value: v}
+			a.msgs[m.id] = m
+			a.pending = append(a.pending, m)
+			a.mu.Unlock()
+		case <-expire:
+		case <-a.wake:
+		case <-a.sub.Done():
+			return
+		}
+		a.withdraw()
+	}
+}
+
+// 交给消费者之前把消息从排队中取出，记为处理中，调用方需持有 a.mu
+func (a *AckSubscription) offerLocked(m *ackMsg) {
+	a.unqueueLocked(m)
+	m.attempts++
+	m.deadline = time.Now().Add(a.opts.VisibilityTimeout)
+	a.timeline = append(a.timeline, ackDeadline{m: m, attempts: m.attempts})
+	a.inFlight++
+	if m.attempts > 1 {
+		a.redelivered++
+	}
+	a.offered = m
+}
+
+// 没有交出去，撤销 offerLocked，消息回到队首
+func (a *AckSubscription) withdraw() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if m := a.offered; m != nil {
+		a.undoOfferLocked(m)
+		// offerLocked 之后只有投递协程会追加时间线，最后一项就是它
+		a.timeline[len(a.timeline)-1] = ackDeadline{}
+		a.timeline = a.timeline[:len(a.timeline)-1]
+		a.pending = append([]*ackMsg{m}, a.pending...)
+	}
+}
+
+// 撤销 offerLocked 的计数，调用方需持有 a.mu
+func (a *AckSubscription) undoOfferLocked(m *ackMsg) {
+	a.offered = nil
+	m.attempts--
+	m.deadline = time.Time{}
+	a.inFlight--
+	if m.attempts > 0 {
+		a.redelivered--
+	}
+}
+
+// 重置定时器，d 不大于0时立即触发
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// 把到期的处理中消息重新排队，返回投递次数已满、需要进入死信的消息，调用方需持有 a.mu
+func (a *AckSubscription) expireLocked(now time.Time) []*ackMsg {
+	var dead []*ackMsg
+	for len(a.timeline) > 0 {
+		d := a.timeline[0]
+		if d.m.attempts == d.attempts && !d.m.deadline.IsZero() && d.m.deadline.After(now) {
+			break
+		}
+		a.timeline[0] = ackDeadline{}
+		a.timeline = a.timeline[1:]
+		if d.m.attempts != d.attempts || d.m.deadline.IsZero() || a.msgs[d.m.id] == nil {
+			continue // 已经确认或者已经重新排队
+		}
+		if m := a.requeueLocked(d.m); m != nil {
+			dead = append(dead, m)
+		}
+	}
+	return dead
+}
+
+// 处理中的消息重新排队，投递次数已满时从 msgs 中删除并返回它，调用方需持有 a.mu
+func (a *AckSubscription) requeueLocked(m *ackMsg) *ackMsg {
+	m.deadline = time.Time{}
+	a.inFlight--
+	if m.attempts >= a.opts.MaxDeliveries {
+		delete(a.msgs, m.id)
+		a.deadLettered++
+		return m
+	}
+	a.pending = append([]*ackMsg{m}, a.pending...)
+	return nil
+}
+
+// 是否是发往死信主题的消息
+func isDeadLetter[T any](e *Envelope[T]) bool {
+	_, ok := interface{}(e.Payload).(*DeadLetter)
+	return ok
+}
+
+// 发布到死信主题
+func (a *AckSubscription) deadLetter(m *ackMsg) {
+	if a.opts.DeadLetter == "" {
+		return
+	}
+	_ = a.p.PublishTo(a.opts.DeadLetter, &DeadLetter{ID: m.id, Deliveries: m.attempts, Value: m.value})
+}
+
+// Ack 或 Nack，receipt 是这次投递时的次数
+func (a *AckSubscription) settle(id uint64, receipt int, requeue bool) error {
+	a.mu.Lock()
+	m, ok := a.msgs[id]
+	if ok && a.offered == m {
+		switch receipt {
+		case m.attempts: // 能拿到回执说明已经交出去了
+			a.offered = nil
+		case m.attempts - 1: // 重投还没交出去，上一次投递当作排队中处理
+			if !requeue {
+				delete(a.msgs, id)
+				a.undoOfferLocked(m)
+			}
+			a.mu.Unlock()
+			signal(a.wake)
+			return nil
+		}
+	}
+	if !ok || receipt != m.attempts {
+		a.mu.Unlock()
+		return ErrUnknownDelivery
+	}
+
+	var dead *ackMsg
+	switch {
+	case m.deadline.IsZero(): // 已经超时、正在排队等待重投
+		if !requeue {
+			delete(a.msgs, id)
+			a.unqueueLocked(m)
+		}
+	case requeue:
+		dead = a.requeueLocked(m)
+	default:
+		delete(a.msgs, id)
+		a.inFlight--
+	}
+	a.mu.Unlock()
+
+	if dead != nil {
+		a.deadLetter(dead)
+	}
+	signal(a.wake)
+	return nil
+}
+
+// 从排队中移除，调用方需持有 a.mu
+func (a *AckSubscription) unqueueLocked(m *ackMsg) bool {
+	for i, q := range a.pending {
+		if q == m {
+			copy(a.pending[i:], a.pending[i+1:])
+			a.pending[len(a.pending)-1] = nil
+			a.pending = a.pending[:len(a.pending)-1]
+			return true
+		}
+	}
+	return false
+}
+
+// 退订，尚未确认的消息被丢弃，可以重复调用
+func (a *AckSubscription) Unsubscribe() {
+	a.sub.Unsubscribe()
+	<-a.done
+}
+
+// 订阅结束后关闭
+func (a *AckSubscription) Done() <-chan struct{} {
+	return a.done
+}
+
+// 订阅结束的原因，主动退订或订阅尚未结束时为 nil
+func (a *AckSubscription) Err() error {
+	return a.sub.Err()
+}
+
+// 统计信息
+func (a *AckSubscription) Stats() AckStats {
+	st := AckStats{SubscriberStats: a.sub.Stats()}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st.InFlight = a.inFlight
+	st.Redelivered = a.redelivered
+	st.DeadLettered = a.deadLettered
+	return st
+}
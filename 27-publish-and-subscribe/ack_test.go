@@ -0,0 +1,252 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func recvDelivery(t *testing.T, a *AckSubscription) *Delivery {
+	t.Helper()
+	select {
+	case d := <-a.C:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for delivery")
+	}
+	return nil
+}
+
+// TestAckSubscription 测试确认后不再重投
+func TestAckSubscription(t *testing.T) {
+	p := NewPublisher(4, time.Second)
+	defer p.Close()
+	a, err := p.SubscribeAck(context.Background(), AckOptions{VisibilityTimeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Unsubscribe()
+
+	p.Publish("a")
+	p.Publish("b")
+	d1, d2 := recvDelivery(t, a), recvDelivery(t, a)
+	if d1.Value != "a" || d2.Value != "b" || d1.ID == d2.ID || d1.Attempt != 1 {
+		t.Fatalf("unexpected deliveries %+v %+v", d1, d2)
+	}
+	if n := a.Stats().InFlight; n != 2 {
+		t.Fatalf("expected 2 in flight, got %d", n)
+	}
+	if err := d1.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d2.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d1.Ack(); !errors.Is(err, ErrUnknownDelivery) {
+		t.Errorf("expected ErrUnknownDelivery, got %v", err)
+	}
+
+	select {
+	case d := <-a.C:
+		t.Errorf("acked message should not be redelivered, got %+v", d)
+	case <-time.After(60 * time.Millisecond):
+	}
+	if st := a.Stats(); st.InFlight != 0 || st.Redelivered != 0 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
+
+// TestAckRedeliver 测试超时未确认和 Nack 后重投
+func TestAckRedeliver(t *testing.T) {
+	p := NewPublisher(4, time.Second)
+	defer p.Close()
+	a, _ := p.SubscribeAck(context.Background(), AckOptions{VisibilityTimeout: 20 * time.Millisecond, MaxDeliveries: 10})
+	defer a.Unsubscribe()
+
+	p.Publish("x")
+	d := recvDelivery(t, a)
+
+	// 超时重投，ID 不变
+	start := time.Now()
+	again := recvDelivery(t, a)
+	if again.ID != d.ID || again.Attempt != 2 {
+		t.Fatalf("expected redelivery of %d, got %+v", d.ID, again)
+	}
+	if time.Since(start) < 10*time.Millisecond {
+		t.Error("redelivered before the visibility timeout")
+	}
+
+	// Nack 立即重投，并且优先于新消息
+	p.Publish("y")
+	if err := again.Nack(); err != nil {
+		t.Fatal(err)
+	}
+	third := recvDelivery(t, a)
+	if third.ID != d.ID || third.Attempt != 3 {
+		t.Fatalf("expected nacked message first, got %+v", third)
+	}
+	_ = third.Ack()
+	if y := recvDelivery(t, a); y.Value != "y" {
+		t.Errorf("expected y, got %v", y.Value)
+	} else {
+		_ = y.Ack()
+	}
+	if st := a.Stats(); st.Redelivered != 2 {
+		t.Errorf("expected 2 redeliveries, got %d", st.Redelivered)
+	}
+}
+
+// TestAckNackRightAfterReceive 测试刚拿到就 Nack 会立即重投，不用等可见性超时
+func TestAckNackRightAfterReceive(t *testing.T) {
+	p := NewPublisher(4, time.Second)
+	defer p.Close()
+	a, _ := p.SubscribeAck(context.Background(), AckOptions{VisibilityTimeout: time.Minute})
+	defer a.Unsubscribe()
+
+	for i := 0; i < 50; i++ {
+		p.Publish(i)
+		d := recvDelivery(t, a)
+		if err := d.Nack(); err != nil {
+			t.Fatal(err)
+		}
+		again := recvDelivery(t, a)
+		if again.ID != d.ID || again.Attempt != 2 {
+			t.Fatalf("expected redelivery of %d, got %+v", d.ID, again)
+		}
+		if err := again.Ack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestAckStaleReceipt 测试重投交出去之后，上一次投递的回执失效
+func TestAckStaleReceipt(t *testing.T) {
+	p := NewPublisher(4, time.Second)
+	defer p.Close()
+	a, _ := p.SubscribeAck(context.Background(), AckOptions{VisibilityTimeout: 20 * time.Millisecond})
+	defer a.Unsubscribe()
+
+	p.Publish("x")
+	first := recvDelivery(t, a)
+	second := recvDelivery(t, a) // 超时重投
+	if err := first.Ack(); !errors.Is(err, ErrUnknownDelivery) {
+		t.Errorf("stale receipt should not ack the redelivery, got %v", err)
+	}
+	if err := first.Nack(); !errors.Is(err, ErrUnknownDelivery) {
+		t.Errorf("stale receipt should not nack the redelivery, got %v", err)
+	}
+	if err := second.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	if st := a.Stats(); st.InFlight != 0 || st.Redelivered != 1 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
+
+// TestAckDeadLetter 测试超过最大投递次数后进入死信主题
+func TestAckDeadLetter(t *testing.T) {
+	p := NewPublisher(4, time.Second)
+	defer p.Close()
+	dlq, _ := p.SubscribePattern("dead.orders")
+	a, err := p.SubscribeAck(context.Background(), AckOptions{
+		VisibilityTimeout: 10 * time.Millisecond,
+		MaxDeliveries:     2,
+		DeadLetter:        "dead.orders",
+	}, WithPattern("orders.#"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Unsubscribe()
+
+	_ = p.PublishTo("orders.eu", "poison")
+	d := recvDelivery(t, a)
+	_ = d.Nack()
+	_ = recvDelivery(t, a) // 第二次，不确认，等超时
+
+	select {
+	case v := <-dlq:
+		dl := v.(*DeadLetter)
+		if dl.ID != d.ID || dl.Deliveries != 2 || dl.Value != "poison" {
+			t.Errorf("unexpected dead letter %+v", dl)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message should be dead-lettered")
+	}
+	if err := d.Ack(); !errors.Is(err, ErrUnknownDelivery) {
+		t.Errorf("dead-lettered message cannot be acked, got %v", err)
+	}
+	if st := a.Stats(); st.DeadLettered != 1 || st.InFlight != 0 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+
+	if _, err := p.SubscribeAck(context.Background(), AckOptions{DeadLetter: "a.*"}); !errors.Is(err, ErrInvalidTopic) {
+		t.Errorf("expected ErrInvalidTopic, got %v", err)
+	}
+}
+
+// TestAckDeadLetterCatchAll 测试不带 WithPattern 的订阅者收不到死信，死信不会循环
+func TestAckDeadLetterCatchAll(t *testing.T) {
+	p := NewPublisher(4, time.Second)
+	defer p.Close()
+	dlq, _ := p.SubscribePattern("dlq")
+	all := p.Subscribe()
+	a, _ := p.SubscribeAck(context.Background(), AckOptions{
+		VisibilityTimeout: 10 * time.Millisecond,
+		MaxDeliveries:     1,
+		DeadLetter:        "dlq",
+	})
+	defer a.Unsubscribe()
+
+	p.Publish("poison")
+	if v := recv(t, all); v != "poison" {
+		t.Fatalf("unexpected message %v", v)
+	}
+	if d := recvDelivery(t, a); d.Value != "poison" {
+		t.Fatalf("unexpected delivery %+v", d)
+	}
+	if dl, ok := recv(t, dlq).(*DeadLetter); !ok || dl.Value != "poison" {
+		t.Fatalf("unexpected dead letter %+v", dl)
+	}
+
+	select {
+	case d := <-a.C:
+		t.Errorf("ack subscriber should not receive its own dead letter, got %+v", d.Value)
+	case v := <-all:
+		t.Errorf("filter subscriber should not receive dead letters, got %+v", v)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if st := a.Stats(); st.DeadLettered != 1 {
+		t.Errorf("expected one dead letter, got %+v", st)
+	}
+}
+
+// TestAckLateAck 测试超时后才确认，排队中的重投被取消
+func TestAckLateAck(t *testing.T) {
+	p := NewPublisher(4, time.Second)
+	defer p.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	a, _ := p.SubscribeAck(ctx, AckOptions{VisibilityTimeout: 10 * time.Millisecond})
+
+	p.Publish("x")
+	d := recvDelivery(t, a)
+	time.Sleep(30 * time.Millisecond) // 已经超时，重投正在排队等消费者来取
+	if err := d.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case d := <-a.C:
+		t.Errorf("acked message should not be redelivered, got %+v", d)
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case <-a.Done():
+	case <-time.After(time.Second):
+		t.Fatal("subscription should end after ctx is cancelled")
+	}
+	if !errors.Is(a.Err(), context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", a.Err())
+	}
+}
@@ -0,0 +1,152 @@
+package pubsub
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+新旧两种投递方式的吞吐量对比：
+
+	go test -bench=Publish -benchmem ./27-publish-and-subscribe/
+
+legacyPublisher 是改造前 Publish 的实现：持有写锁，每个订阅者每条消息一个goroutine，再 wg.Wait
+*/
+type legacyPublisher struct {
+	m           sync.RWMutex
+	timeout     time.Duration
+	subscribers map[subscriber]topicFunc
+}
+
+func (p *legacyPublisher) Publish(v interface{}) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	var wg sync.WaitGroup
+	for sub, topic := range p.subscribers {
+		wg.Add(1)
+		go p.sendTopic(sub, topic, v, &wg)
+	}
+	wg.Wait()
+}
+
+func (p *legacyPublisher) sendTopic(sub subscriber, topic topicFunc, v interface{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if topic != nil && !topic(v) {
+		return
+	}
+	select {
+	case sub <- v:
+	case <-time.After(p.timeout):
+	}
+}
+
+var benchSubscribers = []int{1, 100, 10000}
+
+const benchBuffer = 64
+
+// 每个订阅者一个消费协程，不停地读
+func drain(subs []subscriber) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for _, sub := range subs {
+		wg.Add(1)
+		go func(sub subscriber) {
+			defer wg.Done()
+			for range sub {
+			}
+		}(sub)
+	}
+	return &wg
+}
+
+func BenchmarkPublishLegacy(b *testing.B) {
+	for _, n := range benchSubscribers {
+		b.Run(fmt.Sprintf("subs=%d", n), func(b *testing.B) {
+			p := &legacyPublisher{timeout: time.Second, subscribers: make(map[subscriber]topicFunc)}
+			subs := make([]subscriber, n)
+			for i := range subs {
+				subs[i] = make(subscriber, benchBuffer)
+				p.subscribers[subs[i]] = nil
+			}
+			wg := drain(subs)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p.Publish(i)
+			}
+			b.StopTimer()
+
+			for _, sub := range subs {
+				close(sub)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func BenchmarkPublish(b *testing.B) {
+	for _, n := range benchSubscribers {
+		b.Run(fmt.Sprintf("subs=%d", n), func(b *testing.B) {
+			p := NewPublisher(benchBuffer, time.Second)
+			subs := make([]subscriber, n)
+			for i := range subs {
+				subs[i] = p.Subscribe()
+			}
+			wg := drain(subs)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p.Publish(i)
+			}
+			b.StopTimer()
+
+			p.Close()
+			wg.Wait()
+		})
+	}
+}
+
+// 多个发布者并发发布，旧实现的写锁会让发布者互相排队
+func BenchmarkPublishParallelLegacy(b *testing.B) {
+	p := &legacyPublisher{timeout: time.Second, subscribers: make(map[subscriber]topicFunc)}
+	subs := make([]subscriber, 100)
+	for i := range subs {
+		subs[i] = make(subscriber, benchBuffer)
+		p.subscribers[subs[i]] = nil
+	}
+	wg := drain(subs)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			p.Publish(1)
+		}
+	})
+	b.StopTimer()
+
+	for _, sub := range subs {
+		close(sub)
+	}
+	wg.Wait()
+}
+
+func BenchmarkPublishParallel(b *testing.B) {
+	p := NewPublisher(benchBuffer, time.Second)
+	subs := make([]subscriber, 100)
+	for i := range subs {
+		subs[i] = p.Subscribe()
+	}
+	wg := drain(subs)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			p.Publish(1)
+		}
+	})
+	b.StopTimer()
+
+	p.Close()
+	wg.Wait()
+}
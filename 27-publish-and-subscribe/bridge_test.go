@@ -0,0 +1,293 @@
+package pubsub
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// 在回环地址上启动服务端
+func startServer(t *testing.T, p *Publisher, addr string) (*Server, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(p)
+	go srv.Serve(l)
+	return srv, l.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *Client {
+	t.Helper()
+	c, err := Dial(addr, WithReconnectWait(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// 确认服务端已经处理完之前发送的帧
+func ping(t *testing.T, c *Client) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func recv(t *testing.T, ch subscriber) interface{} {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	return nil
+}
+
+// TestBridgePubSub 测试客户端与本地发布者之间互相收发
+func TestBridgePubSub(t *testing.T) {
+	p := NewPublisher(4, time.Second)
+	defer p.Close()
+	srv, addr := startServer(t, p, "127.0.0.1:0")
+	defer srv.Close()
+
+	c := dial(t, addr)
+	defer c.Close()
+
+	all := c.Subscribe()
+	orders, err := c.SubscribePattern("orders.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	strs := c.SubscribeTopic(func(v interface{}) bool {
+		_, ok := v.(string)
+		return ok
+	})
+	ping(t, c)
+
+	// 本地发布，远端收到
+	p.Publish(1.0)
+	if v := recv(t, all); v != 1.0 {
+		t.Errorf("expected 1, got %v", v)
+	}
+	_ = p.PublishTo("orders.eu", "hello")
+	if v := recv(t, orders); v != "hello" {
+		t.Errorf("expected hello, got %v", v)
+	}
+	if v := recv(t, all); v != "hello" {
+		t.Errorf("expected hello, got %v", v)
+	}
+	if v := recv(t, strs); v != "hello" {
+		t.Errorf("filter should skip non-strings, got %v", v)
+	}
+
+	// 远端发布，本地收到
+	local, _ := p.SubscribePattern("orders.#")
+	c.PublishTo("orders.us.west", "hi")
+	if v := recv(t, local); v != "hi" {
+		t.Errorf("expected hi, got %v", v)
+	}
+	if v := recv(t, all); v != "hi" {
+		t.Errorf("expected hi, got %v", v)
+	}
+
+	if _, err := c.SubscribePattern("a..b"); err == nil {
+		t.Error("invalid pattern should be rejected")
+	}
+
+	// 退订后服务端也不再有这个订阅
+	c.Exit(orders)
+	c.Exit(orders)
+	ping(t, c)
+	if _, ok := <-orders; ok {
+		t.Error("exited subscriber should be closed")
+	}
+	if n := len(p.Stats()); n != 3 {
+		t.Errorf("expected the local subscriber and two remote ones, got %d", n)
+	}
+}
+
+// TestBridgeReconnect 测试服务端重启后客户端自动重连并恢复订阅
+func TestBridgeReconnect(t *testing.T) {
+	p := NewPublisher(4, time.Second)
+	defer p.Close()
+	srv, addr := startServer(t, p, "127.0.0.1:0")
+
+	c := dial(t, addr)
+	defer c.Close()
+	sub, _ := c.SubscribePattern("events.#")
+	ping(t, c)
+
+	srv.Close()
+	if n := len(p.Stats()); n != 0 {
+		t.Fatalf("subscriptions should be removed with the connection, got %d", n)
+	}
+
+	srv, _ = startServer(t, p, addr)
+	defer srv.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		err := c.Ping(ctx)
+		cancel()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("client did not reconnect: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_ = p.PublishTo("events.started", "again")
+	if v := recv(t, sub); v != "again" {
+		t.Errorf("expected again, got %v", v)
+	}
+}
+
+// TestClientClose 测试关闭客户端后订阅者关闭、发布返回错误
+func TestClientClose(t *testing.T) {
+	p := NewPublisher(4, time.Second)
+	defer p.Close()
+	srv, addr := startServer(t, p, "127.0.0.1:0")
+	defer srv.Close()
+
+	c := dial(t, addr)
+	sub := c.Subscribe()
+	c.Close()
+	c.Close()
+
+	if _, ok := <-sub; ok {
+		t.Error("subscriber should be closed")
+	}
+	if err := c.PublishTo("a", 1); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if _, ok := <-c.Subscribe(); ok {
+		t.Error("subscribing after close should return a closed channel")
+	}
+}
+
+// 只接受连接、从不读取的对端
+func stalledPeer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+// 不停地发布直到出错，对端不读时很快就会卡在写上
+func publishUntilError(c *Client) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		payload := make([]byte, 64<<10)
+		for {
+			if err := c.PublishTo("a", payload); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+	time.Sleep(100 * time.Millisecond) // 等缓冲区写满
+	return errc
+}
+
+// TestClientWriteTimeout 测试对端不读时写帧会超时，排在后面的订阅最多等一个写超时
+func TestClientWriteTimeout(t *testing.T) {
+	c, err := Dial(stalledPeer(t), WithWriteTimeout(200*time.Millisecond), WithReconnectWait(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	errc := publishUntilError(c)
+
+	start := time.Now()
+	c.Exit(c.Subscribe())
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Subscribe/Exit should wait at most one write timeout, took %v", d)
+	}
+	select {
+	case err := <-errc:
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			t.Errorf("expected a write timeout, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stalled write should time out")
+	}
+}
+
+// TestClientCloseStalled 测试写被卡住时 Close 立即返回，卡住的发布随之失败
+func TestClientCloseStalled(t *testing.T) {
+	c, err := Dial(stalledPeer(t), WithWriteTimeout(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := publishUntilError(c)
+
+	start := time.Now()
+	c.Close()
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Close should not wait for a stalled write, took %v", d)
+	}
+	select {
+	case <-errc:
+	case <-time.After(time.Second):
+		t.Fatal("Close should abort the stalled write")
+	}
+}
+
+// TestServerStalledClient 测试客户端不读时服务端写超时断开，本地发布者不会一直被拖住
+func TestServerStalledClient(t *testing.T) {
+	p := NewPublisher(1, 500*time.Millisecond)
+	defer p.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(p, WithServerWriteTimeout(100*time.Millisecond))
+	go srv.Serve(l)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := writeFrame(conn, frame{typ: frameSub, sid: 1, topic: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond) // 等服务端处理完 SUB，之后从不读取
+
+	payload := make([]byte, 64<<10)
+	start := time.Now()
+	for i := 0; i < 200; i++ {
+		_ = p.PublishTo("a", payload)
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("a stalled client should be disconnected, publishing took %v", d)
+	}
+}
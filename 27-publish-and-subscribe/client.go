@@ -0,0 +1,444 @@
+package pubsub
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+/*
+网络桥接：客户端
+设计思想：
+
+	Client 与 Publisher 提供相同的发布订阅接口(PubSub)，另一个进程里的代码不需要关心对方是不是本地的
+	1.本地的每个订阅者同样拥有自己的队列和投递协程，溢出策略、过滤器等订阅选项照常生效
+	2.读协程收到 MSG 帧后按 sid 找到订阅者并入队
+	3.连接断开后按 reconnectWait 不断重连，连上后用原来的 sid 重新发送所有 SUB
+	断线期间发布会返回 ErrNotConnected，已有的订阅不会丢，只是收不到断线期间的消息
+	写帧用单独的 wmu 串行化，c.mu 只保护状态，写帧时不持有 c.mu：
+	对端不读导致写阻塞时，读协程、订阅管理和 Close 都不会被拖住
+	每次写帧都有 writeTimeout 的截止时间，超时后连接上可能留下半个帧，直接断开重连
+*/
+var ErrNotConnected = errors.New("pubsub: client not connected")
+
+// Publisher 与 Client 共同的发布订阅接口
+type PubSub interface {
+	Publish(v interface{})
+	PublishTo(topic string, v interface{}) error
+	Subscribe(opts ...SubscribeOption) subscriber
+	SubscribeTopic(topic topicFunc, opts ...SubscribeOption) subscriber
+	SubscribePattern(pattern string, opts ...SubscribeOption) (subscriber, error)
+	Exit(sub subscriber)
+	Close()
+}
+
+var (
+	_ PubSub = (*Publisher)(nil)
+	_ PubSub = (*Client)(nil)
+)
+
+// 客户端选项
+type ClientOption func(*Client)
+
+// 本地订阅队列的大小和阻塞等待的超时时间，与 NewPublisher 的参数含义相同
+func WithClientBuffer(buf int, timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.buffer = buf
+		c.timeout = timeout
+	}
+}
+
+// 断线后重连的间隔
+func WithReconnectWait(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.reconnectWait = d
+	}
+}
+
+// 写一个帧的超时时间，默认 5s
+func WithWriteTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.writeTimeout = d
+	}
+}
+
+// 消息的编解码，需要与服务端 Publisher 的 Codec 一致，默认 JSONCodec
+func WithClientCodec(codec Codec) ClientOption {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+type Client struct {
+	addr          string
+	codec         Codec
+	buffer        int
+	timeout       time.Duration
+	reconnectWait time.Duration
+	writeTimeout  time.Duration
+
+	wmu     sync.Mutex // 写帧
+	mu      sync.Mutex
+	conn    net.Conn // 断线期间为 nil
+	subs    map[uint32]*subState[interface{}]
+	sids    map[subscriber]uint32
+	nextSID uint32
+	pings   []chan error // 等待 PONG 的 Ping 调用，按发送顺序排队
+	closed  bool
+	quit    chan struct{}
+	done    chan struct{} // 读协程已退出
+}
+
+// 连接服务端
+func Dial(addr string, opts ...ClientOption) (*Client, error) {
+	c := &Client{
+		addr:          addr,
+		codec:         JSONCodec{},
+		buffer:        16,
+		timeout:       time.Second,
+		reconnectWait: 100 * time.Millisecond,
+		writeTimeout:  5 * time.Second,
+		subs:          make(map[uint32]*subState[interface{}]),
+		sids:          make(map[subscriber]uint32),
+		quit:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	go c.loop(conn)
+	return c, nil
+}
+
+// 读协程：读到连接出错为止，然后重连
+func (c *Client) loop(conn net.Conn) {
+	defer close(c.done)
+	for {
+		c.read(conn)
+
+		c.mu.Lock()
+		c.conn = nil
+		for _, ping := range c.pings {
+			ping <- ErrNotConnected
+		}
+		c.pings = nil
+		closed := c.closed
+		c.mu.Unlock()
+		conn.Close()
+		if closed {
+			return
+		}
+
+		if conn = c.reconnect(); conn == nil {
+			return
+		}
+	}
+}
+
+// 不断重连直到成功或客户端被关闭，成功后重新发送所有订阅
+func (c *Client) reconnect() net.Conn {
+	for {
+		select {
+		case <-time.After(c.reconnectWait):
+		case <-c.quit:
+			return nil
+		}
+
+		conn, err := net.Dial("tcp", c.addr)
+		if err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		// 新连接还没有对外公开，不会和其他写帧交错，持有 c.mu 保证这期间登记的订阅不会漏发
+		// 有写超时兜底，不会一直卡住
+		for sid, s := range c.subs {
+			if err = c.writeConn(conn, frame{typ: frameSub, sid: sid, topic: s.pattern}); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			c.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		c.conn = conn
+		c.mu.Unlock()
+		return conn
+	}
+}
+
+func (c *Client) read(conn net.Conn) {
+	br := bufio.NewReader(conn)
+	for {
+		f, err := readFrame(br)
+		if err != nil {
+			return
+		}
+
+		switch f.typ {
+		case frameMsg:
+			c.dispatch(f)
+		case framePong:
+			c.mu.Lock()
+			if len(c.pings) > 0 {
+				c.pings[0] <- nil
+				c.pings = c.pings[1:]
+			}
+			c.mu.Unlock()
+		case framePing:
+			_ = c.write(frame{typ: framePong})
+		case frameErr:
+			c.mu.Lock()
+			s, ok := c.subs[f.sid]
+			if ok {
+				c.forget(f.sid, s)
+			}
+			c.mu.Unlock()
+			if ok { // 服务端拒绝了这个订阅
+				s.stop(fmt.Errorf("pubsub: server: %s", f.data))
+			}
+		}
+	}
+}
+
+// 把 MSG 放入对应订阅者的队列
+func (c *Client) dispatch(f frame) {
+	c.mu.Lock()
+	s := c.subs[f.sid]
+	c.mu.Unlock()
+	if s == nil {
+		return
+	}
+	var v interface{}
+	if err := c.codec.Unmarshal(f.data, &v); err != nil {
+		return
+	}
+	e := newEnvelope("", v)
+	if !s.accepts(e) {
+		return
+	}
+
+	switch s.offer(e) {
+	case offerBlocked:
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		if !s.wait(e, ctx.Done()) {
+			s.hooks.onDrop(e, ErrExpired)
+		}
+		cancel()
+	case offerDisconnected:
+		c.mu.Lock()
+		c.forget(f.sid, s)
+		c.mu.Unlock()
+		_ = c.write(frame{typ: frameUnsub, sid: f.sid})
+	}
+}
+
+// 调用方需持有 c.mu
+func (c *Client) forget(sid uint32, s *subState[interface{}]) {
+	delete(c.subs, sid)
+	delete(c.sids, s.ch)
+}
+
+// 向当前连接写一个帧，不持有 c.mu
+func (c *Client) write(f frame) error {
+	c.mu.Lock()
+	conn, err := c.connLocked()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.send(conn, f)
+}
+
+// 向指定连接写一个帧，失败时断开这个连接
+func (c *Client) send(conn net.Conn, f frame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.writeConn(conn, f); err != nil {
+		// 写了一半的帧会让后面的帧错位，断开连接，读协程会负责重连
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+// 调用方需持有 c.mu
+func (c *Client) connLocked() (net.Conn, error) {
+	if c.closed {
+		return nil, ErrClosed
+	}
+	if c.conn == nil {
+		return nil, ErrNotConnected
+	}
+	return c.conn, nil
+}
+
+// 带写超时地写一个帧
+func (c *Client) writeConn(conn net.Conn, f frame) error {
+	if c.writeTimeout > 0 {
+		_ = conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	return writeFrame(conn, f)
+}
+
+// 发布消息，网络错误时消息被丢弃
+func (c *Client) Publish(v interface{}) {
+	_ = c.publish("", v)
+}
+
+// 发布到命名主题
+func (c *Client) PublishTo(topic string, v interface{}) error {
+	if _, err := splitTopic(topic, false); err != nil {
+		return err
+	}
+	return c.publish(topic, v)
+}
+
+func (c *Client) publish(topic string, v interface{}) error {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.write(frame{typ: framePub, topic: topic, data: data})
+}
+
+// 订阅所有消息
+func (c *Client) Subscribe(opts ...SubscribeOption) subscriber {
+	return c.SubscribeTopic(nil, opts...)
+}
+
+// 订阅所有消息，在本地用过滤器过滤
+func (c *Client) SubscribeTopic(topic topicFunc, opts ...SubscribeOption) subscriber {
+	s := c.newSubState(opts)
+	s.filter = topic
+	s.pattern = ""
+	c.register(s)
+	return s.ch
+}
+
+// 订阅命名主题
+func (c *Client) SubscribePattern(pattern string, opts ...SubscribeOption) (subscriber, error) {
+	if _, err := splitTopic(pattern, true); err != nil {
+		return nil, err
+	}
+	s := c.newSubState(opts)
+	s.pattern = pattern
+	c.register(s)
+	return s.ch, nil
+}
+
+func (c *Client) newSubState(opts []SubscribeOption) *subState[interface{}] {
+	s := newSubState[interface{}](c.buffer, opts)
+	s.replay = false // 日志回放只在服务端本地可用
+	return s
+}
+
+// 登记订阅者，已连接时立即发送 SUB，否则等重连时发送
+func (c *Client) register(s *subState[interface{}]) {
+	go s.run()
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		s.stop(ErrClosed)
+		return
+	}
+	c.nextSID++
+	sid := c.nextSID
+	c.subs[sid] = s
+	c.sids[s.ch] = sid
+	// 登记时还没连上的话，重连时会补发 SUB，这里就不再发了
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		_ = c.send(conn, frame{typ: frameSub, sid: sid, topic: s.pattern})
+	}
+}
+
+// 退订，可以重复调用
+func (c *Client) Exit(sub subscriber) {
+	c.mu.Lock()
+	sid, ok := c.sids[sub]
+	var s *subState[interface{}]
+	if ok {
+		s = c.subs[sid]
+		c.forget(sid, s)
+	}
+	c.mu.Unlock()
+	if ok {
+		_ = c.write(frame{typ: frameUnsub, sid: sid})
+		s.stop(nil)
+		<-s.done
+	}
+}
+
+// 发送 PING 并等待 PONG
+func (c *Client) Ping(ctx context.Context) error {
+	ch := make(chan error, 1)
+	c.mu.Lock()
+	if _, err := c.connLocked(); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	// 先排队再发送，PONG 可能在 write 返回之前就到了
+	c.pings = append(c.pings, ch)
+	c.mu.Unlock()
+	if err := c.write(frame{typ: framePing}); err != nil {
+		c.mu.Lock()
+		for i, p := range c.pings {
+			if p == ch {
+				c.pings = append(c.pings[:i], c.pings[i+1:]...)
+				break
+			}
+		}
+		c.mu.Unlock()
+		return err
+	}
+
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 断开连接并关闭所有本地订阅者，可以重复调用
+func (c *Client) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		<-c.done
+		return
+	}
+	c.closed = true
+	close(c.quit)
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	subs := c.subs
+	c.subs = make(map[uint32]*subState[interface{}])
+	c.sids = make(map[subscriber]uint32)
+	c.mu.Unlock()
+
+	for _, s := range subs {
+		s.stop(ErrClosed)
+		<-s.done
+	}
+	<-c.done
+}
@@ -0,0 +1,138 @@
+package pubsub
+
+/*
+订阅者的投递协程
+设计思想：
+
+	原来的 Publish 持有写锁，为每个订阅者的每条消息各起一个goroutine再 wg.Wait，
+	一个慢订阅者就能把所有发布者拖住 timeout 那么久，goroutine 的数量也随消息速率增长
+	现在每个订阅者拥有：
+		1. 一个有界队列，容量就是 buffer，发布者只负责入队
+		2. 一个常驻的投递协程，按顺序把队首交给消费者的chan
+	队首在真正交给消费者之前不会出队，所以队列长度就是"还没被消费的条数"，
+	与原来带缓冲chan的语义保持一致
+*/
+
+// 按订阅选项创建订阅者，队列容量至少为1，否则无缓冲的订阅者永远无法入队
+func newSubState[T any](buffer int, opts []SubscribeOption) *subState[T] {
+	if buffer < 1 {
+		buffer = 1
+	}
+	var o subOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &subState[T]{
+		ch:         make(chan T),
+		filter:     typedFilter[T](o.filter),
+		pattern:    o.pattern,
+		headers:    o.headers,
+		policy:     o.policy,
+		maxDrops:   o.maxDrops,
+		capacity:   buffer,
+		ready:      make(chan struct{}, 1),
+		space:      make(chan struct{}, 1),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+		replay:     o.replay,
+		replayFrom: o.replayFrom,
+	}
+}
+
+// 非阻塞地发出信号，信号已经在chan里时直接忽略
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// 入队，调用方需持有 s.mu
+func (s *subState[T]) push(e *Envelope[T]) {
+	s.queue = append(s.queue, e)
+	s.enqueued++
+	signal(s.ready)
+}
+
+// 投递协程：依次把队首交给消费者，退出时关闭chan
+func (s *subState[T]) run() {
+	defer close(s.done)
+	defer close(s.ch)
+
+	// 两个chan只会用到一个，另一个为 nil，对应的 select 分支永远不会被选中
+	ch, envelopes := s.ch, s.envelopes
+	if envelopes != nil {
+		defer close(envelopes)
+		ch = nil
+	}
+
+	if s.replay && !s.replayLog() {
+		return
+	}
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.ready:
+				continue
+			case <-s.quit:
+				return
+			}
+		}
+		e, evictions := s.queue[0], s.evictions
+		s.mu.Unlock()
+
+		// 先处理积压的变化信号，尽量不把已经被挤掉的队首交出去
+		select {
+		case <-s.ready:
+			continue
+		default:
+		}
+		select {
+		case ch <- e.Payload:
+			s.handedOff(e, evictions)
+		case envelopes <- e:
+			s.handedOff(e, evictions)
+		case <-s.ready: // 队列有变化，队首可能已经被挤掉，重新取
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// 队首已经交给消费者，出队并唤醒阻塞的发布者
+func (s *subState[T]) handedOff(e *Envelope[T], evictions uint64) {
+	s.mu.Lock()
+	s.delivered++
+	switch {
+	case s.closed: // 已经停止，队列已被清空
+	case s.evictions == evictions:
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+	default:
+		// 交付的同时队首被挤掉了，这条消息其实已经送达，不算丢弃(OnDrop 钩子已经调用过了)
+		s.dropped--
+	}
+	s.mu.Unlock()
+	signal(s.space)
+	s.hooks.afterDeliver(e)
+}
+
+// 停止投递协程，队列中尚未交付的消息直接丢弃，err 记录结束的原因，只有第一次生效
+func (s *subState[T]) stop(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopLocked(err)
+}
+
+// 同 stop，调用方需持有 s.mu
+func (s *subState[T]) stopLocked(err error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	s.queue = nil
+	close(s.quit)
+}
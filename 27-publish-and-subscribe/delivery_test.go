@@ -0,0 +1,100 @@
+package pubsub
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDeliveryOrder 测试同一个订阅者收到的消息与发布顺序一致
+func TestDeliveryOrder(t *testing.T) {
+	p := NewPublisher(16, time.Second)
+	defer p.Close()
+
+	sub := p.Subscribe()
+	const n = 1000
+	go func() {
+		for i := 0; i < n; i++ {
+			p.Publish(i)
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		if v := <-sub; v != i {
+			t.Fatalf("expected %d, got %v", i, v)
+		}
+	}
+}
+
+// TestSlowSubscriberDoesNotStallOthers 测试慢订阅者阻塞时，其他发布者依旧可以发布
+func TestSlowSubscriberDoesNotStallOthers(t *testing.T) {
+	p := NewPublisher(1, 200*time.Millisecond)
+	defer p.Close()
+
+	_, _ = p.SubscribePattern("slow") // 永远不消费
+	fast, _ := p.SubscribePattern("fast")
+
+	_ = p.PublishTo("slow", 1)
+	blocked := make(chan struct{})
+	go func() {
+		defer close(blocked)
+		_ = p.PublishTo("slow", 2) // 队列已满，阻塞直到超时
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	_ = p.PublishTo("fast", "hello")
+	if v := <-fast; v != "hello" {
+		t.Errorf("expected hello, got %v", v)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("publish to fast subscriber was stalled for %v", d)
+	}
+	<-blocked
+}
+
+// TestPublishSharesDeadline 测试多个阻塞的订阅者共享同一个超时时间
+func TestPublishSharesDeadline(t *testing.T) {
+	p := NewPublisher(1, 20*time.Millisecond)
+	defer p.Close()
+
+	for i := 0; i < 10; i++ {
+		_ = p.Subscribe()
+	}
+	p.Publish(1)
+
+	start := time.Now()
+	p.Publish(2)
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Errorf("blocked subscribers should share one deadline, took %v", d)
+	}
+}
+
+// TestExitWhilePublishing 测试并发发布时退出订阅
+func TestExitWhilePublishing(t *testing.T) {
+	p := NewPublisher(4, 5*time.Millisecond)
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				p.Publish(j)
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		sub := p.Subscribe()
+		select {
+		case <-sub:
+		case <-time.After(5 * time.Millisecond):
+		}
+		p.Exit(sub)
+		if _, ok := <-sub; ok {
+			t.Fatal("channel should be closed after Exit()")
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,178 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+消息信封与钩子
+设计思想：
+
+	发布的值在内部都被装进一个 Envelope，带上 ID、主题、发布时间和 Headers，
+	订阅者队列里排队的也是信封，普通订阅者只拿到 Payload，SubscribeEnvelopes 的订阅者拿到整个信封
+	1.PublishEnvelope 可以自带 Headers，ID 和 Time 为空时自动补上
+	2.WithHeader 让订阅者只接收 Headers 匹配的消息，与主题、过滤器一起生效
+	3.Use 挂上一组钩子，不需要改动 Publish 就能加入日志、指标、链路追踪：
+		BeforePublish  发布前调用，可以往 Headers 里注入追踪信息，返回错误时放弃发布
+		AfterDeliver   消息交给某个订阅者之后调用
+		OnDrop         消息被某个订阅者丢弃时调用，reason 说明原因
+	钩子调用时不持有发布者的锁，可以在钩子里调用发布者(查看 Stats、把丢弃的消息转发到死信主题等)
+	同一条消息的信封被所有订阅者共享，发布之后请把它当作只读的
+	日志只保存 Payload，回放出来的信封只有 Topic、Time 和 Offset
+*/
+var (
+	ErrQueueFull = errors.New("pubsub: subscriber queue full")
+	ErrEvicted   = errors.New("pubsub: evicted by a newer message")
+	ErrExpired   = errors.New("pubsub: gave up waiting for queue space")
+)
+
+// 消息信封
+type Envelope[T any] struct {
+	ID      string
+	Topic   string // Publish 发布的消息为空
+	Time    time.Time
+	Headers map[string]string
+	Payload T
+	Offset  uint64 // 在日志中的 offset，Logged 为 false 时无意义
+	Logged  bool   // 已经写入日志，重新订阅时用 FromOffset(Offset+1) 接着消费
+}
+
+func newEnvelope[T any](topic string, v T) *Envelope[T] {
+	return &Envelope[T]{ID: uniqueID(), Topic: topic, Time: time.Now(), Payload: v}
+}
+
+// 一组钩子，不需要的可以留空
+type Hooks[T any] struct {
+	BeforePublish func(e *Envelope[T]) error
+	AfterDeliver  func(e *Envelope[T])
+	OnDrop        func(e *Envelope[T], reason error)
+}
+
+// 已经挂上的钩子，写时复制，发布和投递时不需要加锁
+type hookChain[T any] struct {
+	mu    sync.Mutex
+	hooks atomic.Value // []Hooks[T]
+}
+
+func (c *hookChain[T]) use(h Hooks[T]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.list()
+	hooks := make([]Hooks[T], len(old), len(old)+1)
+	copy(hooks, old)
+	c.hooks.Store(append(hooks, h))
+}
+
+// c 为 nil 时没有钩子(例如 Client 的订阅者)
+func (c *hookChain[T]) list() []Hooks[T] {
+	if c == nil {
+		return nil
+	}
+	hooks, _ := c.hooks.Load().([]Hooks[T])
+	return hooks
+}
+
+func (c *hookChain[T]) beforePublish(e *Envelope[T]) error {
+	for _, h := range c.list() {
+		if h.BeforePublish != nil {
+			if err := h.BeforePublish(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *hookChain[T]) afterDeliver(e *Envelope[T]) {
+	for _, h := range c.list() {
+		if h.AfterDeliver != nil {
+			h.AfterDeliver(e)
+		}
+	}
+}
+
+func (c *hookChain[T]) onDrop(e *Envelope[T], reason error) {
+	for _, h := range c.list() {
+		if h.OnDrop != nil {
+			h.OnDrop(e, reason)
+		}
+	}
+}
+
+// 挂上一组钩子，按挂上的顺序调用
+func (p *TypedPublisher[T]) Use(h Hooks[T]) {
+	p.hooks.use(h)
+}
+
+// 发布信封，Topic 为空时等同于 PublishContext，否则等同于 PublishToContext
+func (p *TypedPublisher[T]) PublishEnvelope(ctx context.Context, e *Envelope[T]) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if e.ID == "" {
+		e.ID = uniqueID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	return p.publish(ctx, e)
+}
+
+// 只接收 Headers 中 key 的值为 value 的消息，可以多次使用
+func WithHeader(key, value string) SubscribeOption {
+	return func(s *subOptions) {
+		if s.headers == nil {
+			s.headers = make(map[string]string)
+		}
+		s.headers[key] = value
+	}
+}
+
+// 接收整个信封的订阅句柄
+type EnvelopeSubscription[T any] struct {
+	C <-chan *Envelope[T]
+	subHandle[T]
+}
+
+// 添加一个接收信封的订阅者，ctx 结束时自动退订
+func (p *TypedPublisher[T]) SubscribeEnvelopes(ctx context.Context, opts ...SubscribeOption) (*EnvelopeSubscription[T], error) {
+	s := p.newSubState(opts)
+	s.envelopes = make(chan *Envelope[T])
+	if err := p.subscribe(ctx, s); err != nil {
+		return nil, err
+	}
+	return &EnvelopeSubscription[T]{C: s.envelopes, subHandle: subHandle[T]{p: p, s: s}}, nil
+}
+
+// 订阅条件是否满足：过滤器和 Headers
+func (s *subState[T]) accepts(e *Envelope[T]) bool {
+	for k, v := range s.headers {
+		if e.Headers[k] != v {
+			return false
+		}
+	}
+	return s.filter == nil || s.filter(e.Payload)
+}
+
+var (
+	idOnce   sync.Once
+	idPrefix string
+	idSeq    uint64
+)
+
+// 进程内唯一、跨进程大概率唯一的 ID：随机前缀加自增序号
+func uniqueID() string {
+	idOnce.Do(func() {
+		b := make([]byte, 8)
+		_, _ = rand.Read(b)
+		idPrefix = hex.EncodeToString(b)
+	})
+	return idPrefix + "." + strconv.FormatUint(atomic.AddUint64(&idSeq, 1), 10)
+}
@@ -0,0 +1,219 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestPublishEnvelope 测试信封订阅者拿到完整的元数据，普通订阅者只拿到 Payload
+func TestPublishEnvelope(t *testing.T) {
+	p := NewTypedPublisher[string](4, 10*time.Millisecond)
+	defer p.Close()
+
+	envs, err := p.SubscribeEnvelopes(context.Background(), WithPattern("orders.#"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := p.SubscribeContext(context.Background(), WithPattern("orders.#"))
+
+	before := time.Now()
+	err = p.PublishEnvelope(context.Background(), &Envelope[string]{
+		Topic:   "orders.created",
+		Headers: map[string]string{"trace-id": "abc"},
+		Payload: "hello",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = p.PublishTo("orders.paid", "world")
+
+	e := <-envs.C
+	if e.ID == "" || e.Topic != "orders.created" || e.Headers["trace-id"] != "abc" || e.Payload != "hello" {
+		t.Errorf("unexpected envelope %+v", e)
+	}
+	if e.Time.Before(before) {
+		t.Errorf("publish time should be filled in, got %v", e.Time)
+	}
+	if e2 := <-envs.C; e2.ID == e.ID || e2.Topic != "orders.paid" || e2.Payload != "world" {
+		t.Errorf("unexpected envelope %+v", e2)
+	}
+	if v := <-plain.C; v != "hello" {
+		t.Errorf("expected hello, got %v", v)
+	}
+
+	envs.Unsubscribe()
+	if _, ok := <-envs.C; ok {
+		t.Error("C should be closed after Unsubscribe")
+	}
+	if err := p.PublishEnvelope(context.Background(), &Envelope[string]{Topic: "a.*"}); !errors.Is(err, ErrInvalidTopic) {
+		t.Errorf("expected ErrInvalidTopic, got %v", err)
+	}
+}
+
+// TestWithHeader 测试按 Headers 过滤
+func TestWithHeader(t *testing.T) {
+	p := NewPublisher(4, 10*time.Millisecond)
+	defer p.Close()
+
+	eu := p.Subscribe(WithHeader("region", "eu"), WithHeader("env", "prod"))
+	publish := func(v interface{}, headers map[string]string) {
+		_ = p.PublishEnvelope(context.Background(), &Envelope[interface{}]{Headers: headers, Payload: v})
+	}
+	publish(1, map[string]string{"region": "us", "env": "prod"})
+	publish(2, map[string]string{"region": "eu"})
+	publish(3, map[string]string{"region": "eu", "env": "prod"})
+	p.Publish(4)
+
+	expectMessages(t, eu, 3)
+}
+
+// TestHooks 测试发布前、投递后、丢弃时的钩子
+func TestHooks(t *testing.T) {
+	p := NewTypedPublisher[int](1, 10*time.Millisecond)
+	defer p.Close()
+
+	var (
+		mu        sync.Mutex
+		delivered []string
+		dropped   = map[error]int{}
+	)
+	p.Use(Hooks[int]{
+		BeforePublish: func(e *Envelope[int]) error {
+			if e.Payload < 0 {
+				return errors.New("negative")
+			}
+			if e.Headers == nil {
+				e.Headers = map[string]string{}
+			}
+			e.Headers["trace-id"] = e.ID // 模拟注入追踪信息
+			return nil
+		},
+	})
+	p.Use(Hooks[int]{
+		AfterDeliver: func(e *Envelope[int]) {
+			mu.Lock()
+			defer mu.Unlock()
+			delivered = append(delivered, e.Headers["trace-id"])
+		},
+		OnDrop: func(e *Envelope[int], reason error) {
+			mu.Lock()
+			defer mu.Unlock()
+			dropped[reason]++
+		},
+	})
+
+	envs, _ := p.SubscribeEnvelopes(context.Background())
+	p.Publish(1)
+	e := <-envs.C
+	if e.Headers["trace-id"] != e.ID {
+		t.Errorf("BeforePublish should inject trace-id, got %v", e.Headers)
+	}
+	if err := p.PublishContext(context.Background(), -1); err == nil || err.Error() != "negative" {
+		t.Errorf("BeforePublish error should abort publish, got %v", err)
+	}
+	envs.Unsubscribe()
+
+	newest, _ := p.SubscribeContext(context.Background(), WithOverflow(PolicyDropNewest))
+	oldest, _ := p.SubscribeContext(context.Background(), WithOverflow(PolicyDropOldest))
+	blocked, _ := p.SubscribeContext(context.Background())
+	p.Publish(2)
+	p.Publish(3) // 三个订阅者都满了
+
+	<-newest.C
+	<-oldest.C
+	<-blocked.C
+
+	// AfterDeliver 在交付之后才调用，稍等一下
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		n := len(delivered)
+		mu.Unlock()
+		if n == 4 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(delivered) != 4 || delivered[0] != e.ID {
+		t.Errorf("expected 4 deliveries starting with %s, got %v", e.ID, delivered)
+	}
+	if dropped[ErrQueueFull] != 1 || dropped[ErrEvicted] != 1 || dropped[ErrExpired] != 1 {
+		t.Errorf("unexpected drops %v", dropped)
+	}
+}
+
+// TestHooksReentrant 测试钩子里调用发布者不会死锁
+func TestHooksReentrant(t *testing.T) {
+	p := NewTypedPublisher[string](1, 10*time.Millisecond)
+	closing := make(chan struct{})
+	p.Use(Hooks[string]{
+		AfterDeliver: func(*Envelope[string]) {
+			<-closing
+			time.Sleep(10 * time.Millisecond) // 让 Close 先拿到锁
+			p.Stats()
+		},
+	})
+	sub, _ := p.SubscribeContext(context.Background())
+	p.Publish("a")
+	<-sub.C
+
+	done := make(chan struct{})
+	go func() {
+		p.Close()
+		close(done)
+	}()
+	close(closing)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close deadlocked with an AfterDeliver hook calling Stats")
+	}
+}
+
+// TestOnDropRepublish 测试 OnDrop 把消息转发到死信主题，同时有订阅在等写锁也不会死锁
+func TestOnDropRepublish(t *testing.T) {
+	p := NewTypedPublisher[string](1, 10*time.Millisecond)
+	defer p.Close()
+	slow, _ := p.SubscribeContext(context.Background(), WithPattern("orders"), WithOverflow(PolicyDropNewest))
+	dlq, _ := p.SubscribeContext(context.Background(), WithPattern("dlq"))
+	defer slow.Unsubscribe()
+
+	var once sync.Once
+	p.Use(Hooks[string]{
+		OnDrop: func(e *Envelope[string], reason error) {
+			if e.Topic != "orders" {
+				return
+			}
+			once.Do(func() {
+				// 制造一个等待写锁的订阅，如果发布者此时还持有读锁，下面的发布就会排在它后面
+				go p.SubscribeContext(context.Background())
+				time.Sleep(10 * time.Millisecond)
+			})
+			_ = p.PublishTo("dlq", e.Payload)
+		},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		_ = p.PublishTo("orders", "a") // 入队
+		_ = p.PublishTo("orders", "b") // 队列满，被丢弃并转发
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("OnDrop republishing deadlocked")
+	}
+	select {
+	case v := <-dlq.C:
+		if v != "b" {
+			t.Errorf("expected b in the dead letter topic, got %q", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("dropped message should be republished")
+	}
+}
@@ -0,0 +1,405 @@
+package pubsub
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+持久化的追加日志
+设计思想：
+
+	1.日志由多个段文件组成，文件名是段内第一条记录的 offset，写满 SegmentBytes 后滚动到新段
+	2.每条记录都有一个单调递增的 offset，只追加不修改
+	3.记录格式：长度(4) | crc32(4) | offset(8) | 时间(8) | 主题长度(2) | 主题 | 数据
+	4.打开时扫描最后一个段，截掉写了一半的记录；运行中写入失败时也立即截回写入前的大小，
+	  否则这半条记录会让重新打开时扫描停在这里，后面写入成功的记录全部丢失
+	5.按总大小和保留时间删除最旧的段(活跃段永远不删)，这就是压缩
+	  压缩在打开日志和滚动段时自动进行，写入很少、长时间不滚动时，需要调用方定期调用 Compact 才能按时间清理
+*/
+var (
+	ErrLogClosed     = errors.New("pubsub: log closed")
+	ErrCorruptRecord = errors.New("pubsub: corrupt log record")
+)
+
+const (
+	segmentSuffix      = ".log"
+	recordHeaderSize   = 8         // 长度 + crc
+	recordFixedSize    = 8 + 8 + 2 // offset + 时间 + 主题长度
+	defaultSegmentSize = 1 << 20   // 1MB
+	maxRecordSize      = 64 << 20  // 单条记录的上限，防止读到损坏的长度时分配过大的内存
+)
+
+// 日志的配置
+type LogOptions struct {
+	SegmentBytes   int64         // 单个段文件的大小上限，默认 1MB
+	RetentionBytes int64         // 所有段文件的总大小上限，0 表示不限制
+	RetentionAge   time.Duration // 记录的最长保留时间，0 表示不限制
+}
+
+// 日志中的一条记录
+type Record struct {
+	Offset uint64
+	Time   time.Time
+	Topic  string
+	Data   []byte
+}
+
+type segment struct {
+	base   uint64    // 段内第一条记录的 offset
+	next   uint64    // 段内最后一条记录的 offset + 1
+	size   int64     // 文件大小
+	newest time.Time // 段内最新一条记录的时间
+	path   string
+}
+
+type Log struct {
+	mu       sync.RWMutex
+	dir      string
+	opts     LogOptions
+	segments []*segment // 按 base 升序，最后一个是活跃段
+	active   segmentFile
+	now      func() time.Time
+	closed   bool
+	broken   error // 写入失败后没能截回，之后的写入都返回这个错误
+}
+
+// 活跃段文件，测试中可以替换成会写失败的实现
+type segmentFile interface {
+	io.WriteSeeker
+	io.Closer
+	Truncate(size int64) error
+	Sync() error
+}
+
+// 打开目录下的日志，目录不存在时创建
+func OpenLog(dir string, opts LogOptions) (*Log, error) {
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = defaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	l := &Log{dir: dir, opts: opts, now: time.Now}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	if len(l.segments) == 0 {
+		if err := l.roll(0); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+
+	last := l.segments[len(l.segments)-1]
+	f, err := os.OpenFile(last.path, os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// 截掉崩溃时写了一半的记录
+	if err := f.Truncate(last.size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(last.size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	l.active = f
+	// 关闭期间过期的段，不等下一次滚动
+	if err := l.compact(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// 扫描目录中已有的段文件
+func (l *Log) load() error {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		base, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		l.segments = append(l.segments, &segment{base: base, next: base, path: filepath.Join(l.dir, name)})
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i].base < l.segments[j].base })
+
+	for _, seg := range l.segments {
+		err := scanSegment(seg.path, func(r Record, end int64) bool {
+			seg.next = r.Offset + 1
+			seg.size = end
+			seg.newest = r.Time
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 顺序读取段文件，fn 的 end 是这条记录结束的位置；遇到截断或损坏的记录就停下
+func scanSegment(path string, fn func(r Record, end int64) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var pos int64
+	for {
+		r, n, err := readRecord(br)
+		if err == io.EOF || err == io.ErrUnexpectedEOF || errors.Is(err, ErrCorruptRecord) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		pos += n
+		if !fn(r, pos) {
+			return nil
+		}
+	}
+}
+
+func readRecord(r io.Reader) (Record, int64, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Record{}, 0, err
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size < recordFixedSize || size > maxRecordSize {
+		return Record{}, 0, ErrCorruptRecord
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Record{}, 0, err
+	}
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[4:8]) {
+		return Record{}, 0, ErrCorruptRecord
+	}
+
+	topicLen := int(binary.BigEndian.Uint16(body[16:18]))
+	if recordFixedSize+topicLen > len(body) {
+		return Record{}, 0, ErrCorruptRecord
+	}
+	rec := Record{
+		Offset: binary.BigEndian.Uint64(body[0:8]),
+		Time:   time.Unix(0, int64(binary.BigEndian.Uint64(body[8:16]))),
+		Topic:  string(body[recordFixedSize : recordFixedSize+topicLen]),
+		Data:   body[recordFixedSize+topicLen:],
+	}
+	return rec, int64(recordHeaderSize + size), nil
+}
+
+func encodeRecord(r Record) []byte {
+	size := recordFixedSize + len(r.Topic) + len(r.Data)
+	buf := make([]byte, recordHeaderSize+size)
+	body := buf[recordHeaderSize:]
+	binary.BigEndian.PutUint64(body[0:8], r.Offset)
+	binary.BigEndian.PutUint64(body[8:16], uint64(r.Time.UnixNano()))
+	binary.BigEndian.PutUint16(body[16:18], uint16(len(r.Topic)))
+	copy(body[recordFixedSize:], r.Topic)
+	copy(body[recordFixedSize+len(r.Topic):], r.Data)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(size))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(body))
+	return buf
+}
+
+// 新建一个以 base 开头的活跃段，调用方需持有写锁
+func (l *Log) roll(base uint64) error {
+	path := filepath.Join(l.dir, fmt.Sprintf("%020d%s", base, segmentSuffix))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if l.active != nil {
+		l.active.Close()
+	}
+	l.active = f
+	l.segments = append(l.segments, &segment{base: base, next: base, path: path})
+	return nil
+}
+
+// 追加一条记录，返回它的 offset
+func (l *Log) Append(topic string, data []byte) (uint64, error) {
+	if len(topic) > 1<<16-1 {
+		return 0, fmt.Errorf("%w: topic too long", ErrInvalidTopic)
+	}
+	if recordFixedSize+len(topic)+len(data) > maxRecordSize {
+		return 0, fmt.Errorf("pubsub: record too large (%d bytes)", len(data))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return 0, ErrLogClosed
+	}
+	if l.broken != nil {
+		return 0, l.broken
+	}
+
+	seg := l.segments[len(l.segments)-1]
+	if seg.size >= l.opts.SegmentBytes {
+		if err := l.roll(seg.next); err != nil {
+			return 0, err
+		}
+		seg = l.segments[len(l.segments)-1]
+		_ = l.compact() // 压缩失败不影响写入，下次滚动时会再试
+	}
+
+	rec := Record{Offset: seg.next, Time: l.now(), Topic: topic, Data: data}
+	buf := encodeRecord(rec)
+	if _, err := l.active.Write(buf); err != nil {
+		// 截掉可能写了一半的记录
+		if terr := l.rewind(seg.size); terr != nil {
+			l.broken = fmt.Errorf("pubsub: log unusable after failed write: %v (truncate: %v)", err, terr)
+			return 0, l.broken
+		}
+		return 0, err
+	}
+	seg.next++
+	seg.size += int64(len(buf))
+	seg.newest = rec.Time
+	return rec.Offset, nil
+}
+
+// 把活跃段截回 size 并把写入位置移到末尾，调用方需持有写锁
+func (l *Log) rewind(size int64) error {
+	if err := l.active.Truncate(size); err != nil {
+		return err
+	}
+	_, err := l.active.Seek(size, io.SeekStart)
+	return err
+}
+
+// 最早一条仍然保留的记录的 offset
+func (l *Log) Earliest() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.segments[0].base
+}
+
+// 下一条记录将要使用的 offset，从这里开始订阅就是只看新消息
+func (l *Log) Latest() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.segments[len(l.segments)-1].next
+}
+
+// 依次读取 offset >= from 的记录，直到调用时的最新记录为止，fn 返回 false 时停止
+func (l *Log) Read(from uint64, fn func(Record) bool) error {
+	return l.readRange(from, l.Latest(), fn)
+}
+
+// 读取 [from, to) 范围内的记录，已经被压缩掉的部分直接跳过
+func (l *Log) readRange(from, to uint64, fn func(Record) bool) error {
+	l.mu.RLock()
+	if l.closed {
+		l.mu.RUnlock()
+		return ErrLogClosed
+	}
+	segs := make([]segment, 0, len(l.segments))
+	for _, seg := range l.segments {
+		if seg.next > from && seg.base < to {
+			segs = append(segs, *seg)
+		}
+	}
+	l.mu.RUnlock()
+
+	for _, seg := range segs {
+		stop := false
+		err := scanSegment(seg.path, func(r Record, _ int64) bool {
+			if r.Offset >= to {
+				stop = true
+				return false
+			}
+			if r.Offset >= from && !fn(r) {
+				stop = true
+				return false
+			}
+			return true
+		})
+		if os.IsNotExist(err) { // 读的过程中被压缩掉了
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if stop {
+			return nil
+		}
+	}
+	return nil
+}
+
+// 按保留策略删除最旧的段
+func (l *Log) Compact() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrLogClosed
+	}
+	return l.compact()
+}
+
+// 调用方需持有写锁，活跃段永远不会被删除
+func (l *Log) compact() error {
+	var total int64
+	for _, seg := range l.segments {
+		total += seg.size
+	}
+
+	now := l.now()
+	for len(l.segments) > 1 {
+		oldest := l.segments[0]
+		expired := l.opts.RetentionAge > 0 && now.Sub(oldest.newest) > l.opts.RetentionAge
+		oversize := l.opts.RetentionBytes > 0 && total > l.opts.RetentionBytes
+		if !expired && !oversize {
+			break
+		}
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= oldest.size
+		l.segments = l.segments[1:]
+	}
+	return nil
+}
+
+// 关闭日志，已写入的数据会刷到磁盘
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	if err := l.active.Sync(); err != nil {
+		l.active.Close()
+		return err
+	}
+	return l.active.Close()
+}
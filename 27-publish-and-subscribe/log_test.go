@@ -0,0 +1,239 @@
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readAll(t *testing.T, l *Log, from uint64) []Record {
+	t.Helper()
+	var recs []Record
+	if err := l.Read(from, func(r Record) bool {
+		recs = append(recs, r)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return recs
+}
+
+// TestLogAppendAndRead 测试追加与读取，offset 单调递增
+func TestLogAppendAndRead(t *testing.T) {
+	l, err := OpenLog(t.TempDir(), LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for i := 0; i < 5; i++ {
+		off, err := l.Append("orders.eu", []byte(fmt.Sprint(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if off != uint64(i) {
+			t.Errorf("expected offset %d, got %d", i, off)
+		}
+	}
+	if l.Earliest() != 0 || l.Latest() != 5 {
+		t.Errorf("unexpected range [%d, %d)", l.Earliest(), l.Latest())
+	}
+
+	recs := readAll(t, l, 2)
+	if len(recs) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(recs))
+	}
+	for i, r := range recs {
+		if r.Offset != uint64(i+2) || r.Topic != "orders.eu" || string(r.Data) != fmt.Sprint(i+2) {
+			t.Errorf("unexpected record %+v", r)
+		}
+	}
+}
+
+// TestLogReopen 测试重新打开日志后 offset 接着往下走，写了一半的记录会被截掉
+func TestLogReopen(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenLog(dir, LogOptions{SegmentBytes: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := l.Append("t", []byte("payload")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	// 模拟崩溃：最后一个段末尾多了半条记录
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if len(matches) < 2 {
+		t.Fatalf("expected segments to roll, got %d", len(matches))
+	}
+	last := matches[len(matches)-1]
+	f, _ := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0o644)
+	f.Write([]byte{0, 0, 0, 40, 1, 2})
+	f.Close()
+
+	l, err = OpenLog(dir, LogOptions{SegmentBytes: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if l.Latest() != 10 {
+		t.Fatalf("expected latest 10, got %d", l.Latest())
+	}
+	off, err := l.Append("t", []byte("after"))
+	if err != nil || off != 10 {
+		t.Fatalf("expected offset 10, got %d %v", off, err)
+	}
+	recs := readAll(t, l, 0)
+	if len(recs) != 11 || string(recs[10].Data) != "after" {
+		t.Errorf("unexpected records after reopen: %d", len(recs))
+	}
+}
+
+// TestLogCompactBySize 测试按总大小压缩，只删除完整的旧段
+func TestLogCompactBySize(t *testing.T) {
+	l, err := OpenLog(t.TempDir(), LogOptions{SegmentBytes: 100, RetentionBytes: 250})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for i := 0; i < 50; i++ {
+		if _, err := l.Append("t", []byte("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if l.Earliest() == 0 {
+		t.Error("old segments should be compacted")
+	}
+	recs := readAll(t, l, 0)
+	if len(recs) == 0 || recs[0].Offset != l.Earliest() || recs[len(recs)-1].Offset != 49 {
+		t.Errorf("unexpected records after compaction: first %d, earliest %d", recs[0].Offset, l.Earliest())
+	}
+	var total int64
+	for _, seg := range l.segments {
+		total += seg.size
+	}
+	if total > 250+100 {
+		t.Errorf("retained %d bytes, expected around 250", total)
+	}
+}
+
+// TestLogCompactByAge 测试按时间压缩，使用假时钟
+func TestLogCompactByAge(t *testing.T) {
+	l, err := OpenLog(t.TempDir(), LogOptions{SegmentBytes: 50, RetentionAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	for i := 0; i < 5; i++ {
+		l.Append("old", []byte("0123456789"))
+	}
+	now = now.Add(2 * time.Hour)
+	for i := 0; i < 5; i++ {
+		l.Append("new", []byte("0123456789"))
+	}
+	if err := l.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 每条记录 39 字节，两条一个段：offset 4(old) 和 5(new) 在同一个段里，按段删除所以 4 会被保留
+	if l.Earliest() != 4 {
+		t.Errorf("expected earliest 4, got %d", l.Earliest())
+	}
+	for _, r := range readAll(t, l, 0) {
+		if r.Topic == "old" && r.Offset != 4 {
+			t.Errorf("expired record %d should be compacted", r.Offset)
+		}
+	}
+	if l.Latest() != 10 {
+		t.Errorf("expected latest 10, got %d", l.Latest())
+	}
+}
+
+// 写一半就失败的段文件
+type failingSegment struct {
+	segmentFile
+	fail bool
+}
+
+func (f *failingSegment) Write(p []byte) (int, error) {
+	if f.fail {
+		n, _ := f.segmentFile.Write(p[:len(p)/2])
+		return n, errors.New("disk full")
+	}
+	return f.segmentFile.Write(p)
+}
+
+// TestLogWriteFailure 测试写入失败时截掉写了一半的记录，之后写入的记录重新打开后还在
+func TestLogWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenLog(dir, LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &failingSegment{segmentFile: l.active}
+	l.active = fs
+
+	l.Append("a", []byte("ok"))
+	fs.fail = true
+	if _, err := l.Append("a", []byte("lost")); err == nil {
+		t.Fatal("expected write error")
+	}
+	fs.fail = false
+	if off, err := l.Append("a", []byte("after")); err != nil || off != 1 {
+		t.Fatalf("append after failure = %d, %v", off, err)
+	}
+	l.Close()
+
+	l, err = OpenLog(dir, LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	recs := readAll(t, l, 0)
+	if len(recs) != 2 || string(recs[1].Data) != "after" {
+		t.Errorf("records after a failed write should survive reopen, got %+v", recs)
+	}
+}
+
+// TestLogCompactOnOpen 测试重新打开时按保留时间删除过期的段
+func TestLogCompactOnOpen(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenLog(dir, LogOptions{SegmentBytes: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	l.now = func() time.Time { return old }
+	for i := 0; i < 4; i++ {
+		l.Append("old", []byte("0123456789"))
+	}
+	l.now = time.Now
+	for i := 0; i < 2; i++ {
+		l.Append("new", []byte("0123456789"))
+	}
+	l.Close()
+
+	l, err = OpenLog(dir, LogOptions{SegmentBytes: 50, RetentionAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// 每条记录 39 字节，两条一个段：offset 0-3 在两个过期的段里
+	if l.Earliest() != 4 {
+		t.Errorf("expired segments should be removed on open, earliest %d", l.Earliest())
+	}
+}
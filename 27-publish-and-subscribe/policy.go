@@ -0,0 +1,191 @@
+package pubsub
+
+/*
+慢订阅者的处理策略
+设计思想：
+
+	订阅者的队列满了之后，不同的业务需要不同的取舍，所以把策略做成订阅时的选项：
+		PolicyBlock       阻塞等待，最长等待发布者的 timeout，超时丢弃（默认，与原来的行为一致）
+		PolicyDropNewest  立即丢弃新消息
+		PolicyDropOldest  挤掉队列中最旧的消息，队列相当于一个环形缓冲区
+		PolicyDisconnect  立即丢弃新消息，累计丢弃 N 条后断开订阅(关闭channel)
+	入队、交给消费者和丢弃分别计数，通过 Publisher.Stats 可以看出订阅者是否健康：
+	健康的订阅者 Delivered 紧跟着 Enqueued，Dropped 为 0；PolicyDropOldest 挤掉的消息只算丢弃，不算交给了消费者
+*/
+type OverflowPolicy int
+
+const (
+	PolicyBlock OverflowPolicy = iota
+	PolicyDropNewest
+	PolicyDropOldest
+	PolicyDisconnect
+)
+
+func (o OverflowPolicy) String() string {
+	switch o {
+	case PolicyBlock:
+		return "block"
+	case PolicyDropNewest:
+		return "drop-newest"
+	case PolicyDropOldest:
+		return "drop-oldest"
+	case PolicyDisconnect:
+		return "disconnect"
+	}
+	return "unknown"
+}
+
+// 订阅选项，与消息类型无关，创建订阅者时再转成 subState[T] 的字段
+type subOptions struct {
+	filter     func(v interface{}) bool
+	pattern    string
+	headers    map[string]string
+	policy     OverflowPolicy
+	maxDrops   uint64
+	replay     bool
+	replayFrom uint64
+}
+
+// 订阅选项，函数式选项模式
+type SubscribeOption func(*subOptions)
+
+// 指定channel满时的处理策略
+func WithOverflow(policy OverflowPolicy) SubscribeOption {
+	return func(s *subOptions) {
+		s.policy = policy
+	}
+}
+
+// 累计丢弃 n 条消息后断开订阅，n 小于 1 时按 1 处理
+func WithDisconnectAfter(n int) SubscribeOption {
+	return func(s *subOptions) {
+		if n < 1 {
+			n = 1
+		}
+		s.policy = PolicyDisconnect
+		s.maxDrops = uint64(n)
+	}
+}
+
+// 订阅者的统计信息
+type SubscriberStats struct {
+	Pattern   string // 命名主题订阅者订阅的主题，过滤器订阅者为空
+	Policy    OverflowPolicy
+	Enqueued  uint64 // 成功放入队列的条数
+	Delivered uint64 // 消费者真正收到的条数
+	Dropped   uint64 // 被丢弃的条数
+	Pending   int    // 队列中尚未被消费的条数
+}
+
+// 所有订阅者的统计信息，已经断开的订阅者不再统计
+func (p *TypedPublisher[T]) Stats() map[<-chan T]SubscriberStats {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	stats := make(map[<-chan T]SubscriberStats, len(p.subscribers)+len(p.patterns))
+	for _, subs := range []map[chan T]*subState[T]{p.subscribers, p.patterns} {
+		for ch, s := range subs {
+			if st, ok := s.stats(); ok {
+				stats[ch] = st
+			}
+		}
+	}
+	return stats
+}
+
+func (s *subState[T]) stats() (SubscriberStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SubscriberStats{
+		Pattern:   s.pattern,
+		Policy:    s.policy,
+		Enqueued:  s.enqueued,
+		Delivered: s.delivered,
+		Dropped:   s.dropped,
+		Pending:   len(s.queue),
+	}, !s.closed
+}
+
+// 入队的结果
+type offerResult int
+
+const (
+	offerDone         offerResult = iota // 已入队或已按策略丢弃
+	offerBlocked                         // 队列已满，需要阻塞等待
+	offerDisconnected                    // 丢弃次数达到上限，订阅者已断开
+)
+
+// 按策略把消息放入队列，不会阻塞，OnDrop 钩子在释放锁之后调用
+func (s *subState[T]) offer(e *Envelope[T]) offerResult {
+	s.mu.Lock()
+	res, dropped, reason := s.offerLocked(e)
+	s.mu.Unlock()
+	if dropped != nil {
+		s.hooks.onDrop(dropped, reason)
+	}
+	return res
+}
+
+// 同 offer，同时返回被丢弃的消息和原因，调用方需持有 s.mu
+func (s *subState[T]) offerLocked(e *Envelope[T]) (offerResult, *Envelope[T], error) {
+	if s.closed {
+		return offerDone, nil, nil
+	}
+	if len(s.queue) < s.capacity {
+		s.push(e)
+		return offerDone, nil, nil
+	}
+
+	switch s.policy {
+	case PolicyBlock:
+		return offerBlocked, nil, nil
+	case PolicyDropOldest: // 挤掉最旧的一条，队列相当于环形缓冲区
+		oldest := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.evictions++
+		s.dropped++
+		s.push(e)
+		return offerDone, oldest, ErrEvicted
+	case PolicyDisconnect:
+		s.dropped++
+		if s.dropped >= s.maxDrops {
+			s.stopLocked(ErrDisconnected)
+			return offerDisconnected, e, ErrQueueFull
+		}
+	default:
+		s.dropped++
+	}
+	return offerDone, e, ErrQueueFull
+}
+
+// 阻塞等待队列腾出空间，expired 关闭时放弃并丢弃，只有超时放弃时返回 false，
+// 这时由调用方以 ErrExpired 调用 OnDrop 钩子
+func (s *subState[T]) wait(e *Envelope[T], expired <-chan struct{}) bool {
+	for {
+		select {
+		case <-s.space:
+		case <-expired: // 超时放弃
+			s.mu.Lock()
+			s.dropped++
+			s.mu.Unlock()
+			return false
+		case <-s.quit:
+			return true
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return true
+		}
+		if len(s.queue) < s.capacity {
+			s.push(e)
+			if len(s.queue) < s.capacity {
+				signal(s.space) // 还有空位，把信号传给下一个等待者
+			}
+			s.mu.Unlock()
+			return true
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,132 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+)
+
+// 消费者收到消息之后投递协程才记下 Delivered，等统计满足 ok 或超时，返回最后一次的统计
+func waitStats(t *testing.T, stats func() SubscriberStats, ok func(SubscriberStats) bool) SubscriberStats {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	st := stats()
+	for !ok(st) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		st = stats()
+	}
+	return st
+}
+
+// TestPolicyBlockCountsTimeout 测试默认策略下超时丢弃会被计数
+func TestPolicyBlockCountsTimeout(t *testing.T) {
+	p := NewPublisher(1, 5*time.Millisecond)
+	defer p.Close()
+
+	sub := p.Subscribe()
+	p.Publish(1)
+	p.Publish(2) // channel已满，超时丢弃
+
+	st := p.Stats()[sub]
+	if st.Policy != PolicyBlock || st.Enqueued != 1 || st.Delivered != 0 || st.Dropped != 1 || st.Pending != 1 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
+
+// TestPolicyDropNewest 测试丢弃新消息，且不会等待超时
+func TestPolicyDropNewest(t *testing.T) {
+	p := NewPublisher(2, time.Second)
+	defer p.Close()
+
+	sub := p.Subscribe(WithOverflow(PolicyDropNewest))
+	start := time.Now()
+	for i := 1; i <= 5; i++ {
+		p.Publish(i)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("drop-newest should not wait for timeout, took %v", d)
+	}
+
+	if v := <-sub; v != 1 {
+		t.Errorf("expected 1, got %v", v)
+	}
+	if v := <-sub; v != 2 {
+		t.Errorf("expected 2, got %v", v)
+	}
+	ok := func(st SubscriberStats) bool { return st.Enqueued == 2 && st.Delivered == 2 && st.Dropped == 3 }
+	if st := waitStats(t, func() SubscriberStats { return p.Stats()[sub] }, ok); !ok(st) {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
+
+// TestPolicyDropOldest 测试环形缓冲区，保留最新的消息
+func TestPolicyDropOldest(t *testing.T) {
+	p := NewPublisher(2, time.Second)
+	defer p.Close()
+
+	sub := p.Subscribe(WithOverflow(PolicyDropOldest))
+	for i := 1; i <= 5; i++ {
+		p.Publish(i)
+	}
+
+	if v := <-sub; v != 4 {
+		t.Errorf("expected 4, got %v", v)
+	}
+	if v := <-sub; v != 5 {
+		t.Errorf("expected 5, got %v", v)
+	}
+	// 被挤掉的 3 条只算丢弃，消费者真正收到的只有 2 条
+	ok := func(st SubscriberStats) bool { return st.Enqueued == 5 && st.Delivered == 2 && st.Dropped == 3 }
+	if st := waitStats(t, func() SubscriberStats { return p.Stats()[sub] }, ok); !ok(st) {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
+
+// TestPolicyDisconnect 测试累计丢弃后断开订阅
+func TestPolicyDisconnect(t *testing.T) {
+	p := NewPublisher(1, time.Second)
+	defer p.Close()
+
+	slow, _ := p.SubscribePattern("orders.#", WithDisconnectAfter(2))
+	healthy := p.Subscribe()
+
+	for i := 1; i <= 3; i++ {
+		if err := p.PublishTo("orders.eu", i); err != nil {
+			t.Fatal(err)
+		}
+		<-healthy
+	}
+
+	if _, ok := p.Stats()[slow]; ok {
+		t.Error("slow subscriber should be removed after too many drops")
+	}
+	// 断开后未消费的消息被丢弃，chan会被关闭
+	for range slow {
+	}
+	ok := func(st SubscriberStats) bool { return st.Delivered == 3 && st.Dropped == 0 }
+	if st := waitStats(t, func() SubscriberStats { return p.Stats()[healthy] }, ok); !ok(st) {
+		t.Errorf("healthy subscriber should not be affected: %+v", st)
+	}
+}
+
+// TestBlockedPublishDoesNotStall 测试阻塞等待慢订阅者时不持有锁，订阅和其他主题的发布不受影响
+func TestBlockedPublishDoesNotStall(t *testing.T) {
+	p := NewPublisher(1, time.Second)
+	defer p.Close()
+	slow, _ := p.SubscribePattern("slow")
+	defer p.Exit(slow)
+
+	_ = p.PublishTo("slow", 1)
+	go func() { _ = p.PublishTo("slow", 2) }() // 队列已满，阻塞等待
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	sub := p.Subscribe()
+	defer p.Exit(sub)
+	if err := p.PublishTo("other", 3); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Errorf("subscribe and unrelated publish should not wait for the slow subscriber, took %v", d)
+	}
+	<-sub // 过滤器订阅者收到了 3
+}
@@ -1,6 +1,8 @@
 package pubsub
 
 import (
+	"context"
+	"fmt"
 	"sync"
 	"time"
 )
@@ -16,82 +18,383 @@ import (
 
 	publisher结构体中包含属性为subscribers的map结构，该map key为channel，
 	通过Publish方法，将消息发送到channel中
+
+	除了过滤器函数，还支持按命名主题订阅(见 topic.go)：
+	SubscribePattern 订阅 "orders.*.created" 这类主题，PublishTo 向指定主题发布，
+	命名订阅者由前缀树路由，过滤器订阅者依旧会收到 PublishTo 发布的消息，请求响应(见 request.go)和死信(见 ack.go)除外
+
+	每个订阅者可以单独指定队列满时的处理策略(见 policy.go)，
+	投递和丢弃的条数都会被记录下来，通过 Stats 查看
+
+	每个订阅者拥有自己的队列和一个常驻的投递协程(见 delivery.go)，
+	Publish 只在入队时持有读锁，队列满需要阻塞等待时已经放开了锁，慢订阅者不会拖住其他发布者和订阅，
+	同一个订阅者收到消息的顺序与入队顺序一致
+
+	SubscribeContext 返回订阅句柄(见 subscription.go)，ctx 结束时自动退订，
+	PublishContext 用 ctx 代替固定的 timeout 控制阻塞等待
+
+	通过 WithLog 可以把消息写入持久化日志(见 log.go、replay.go)，晚到的订阅者可以回放历史消息
+
+	Request/Respond 在发布订阅之上实现请求响应(见 request.go)，回复收件箱就是一个普通的命名主题
+
+	SubscribeAck 提供至少一次投递(见 ack.go)，消费者确认之前消息会在超时后重投，多次失败进入死信主题
+
+	Server 把发布者暴露到 TCP 上，Client 在另一个进程里提供同样的发布订阅接口(见 wire.go、server.go、client.go)
+
+	发布的值在内部被装进带 ID、时间和 Headers 的信封(见 envelope.go)，通过 Use 挂上的钩子可以观察发布、投递和丢弃
+
+	真正的实现是泛型的 TypedPublisher[T]，订阅者收到的直接是 T，过滤器函数也是 func(T) bool，
+	不再需要类型断言；Publisher 只是内嵌了 TypedPublisher[interface{}]，保留原来基于 interface{} 的接口，
+	请求响应、确认投递这些需要在消息里夹带其他类型的功能只在 Publisher 上提供
 */
 type (
-	subscriber chan interface{}
+	subscriber = chan interface{}
 	topicFunc  func(v interface{}) bool // 过滤器函数
 )
 
-// EventBus 角色
+// 订阅者的状态：通道、订阅条件、溢出策略、消息队列以及计数器
+type subState[T any] struct {
+	ch        chan T
+	envelopes chan *Envelope[T] // 接收信封的订阅者使用，不为 nil 时不再往 ch 投递
+	filter    func(T) bool      // 过滤器订阅者使用
+	pattern   string            // 命名主题订阅者使用
+	headers   map[string]string // 要求匹配的 Headers
+	policy    OverflowPolicy
+	maxDrops  uint64 // PolicyDisconnect 下允许丢弃的条数
+	hooks     *hookChain[T]
+
+	mu        sync.Mutex
+	queue     []*Envelope[T] // 队首的消息在真正交给消费者之前不会出队
+	capacity  int
+	evictions uint64 // PolicyDropOldest 挤掉队首的次数，投递协程用来判断队首是否变了
+	closed    bool
+	err       error  // 订阅结束的原因
+	enqueued  uint64 // 成功入队的条数
+	delivered uint64 // 交给消费者的条数
+	dropped   uint64 // 被丢弃的条数
+
+	ready chan struct{} // 队列有变化，唤醒投递协程
+	space chan struct{} // 队列腾出空间，唤醒阻塞的发布者
+	quit  chan struct{}
+	done  chan struct{} // 投递协程已退出，chan已关闭
+
+	replay     bool   // 是否需要先回放日志
+	replayFrom uint64 // 回放的起点
+	replayTo   uint64 // 登记时日志的末尾
+	log        *Log
+	codec      Codec
+}
+
+// EventBus 角色，消息类型为 T
+type TypedPublisher[T any] struct {
+	m           sync.RWMutex            //读写锁
+	buffer      int                     //订阅队列的大小
+	timeout     time.Duration           //发布超时时间
+	subscribers map[chan T]*subState[T] //订阅者信息
+	patterns    map[chan T]*subState[T] //命名主题订阅者
+	router      *topicTrie[T]           //命名主题路由
+	closed      bool                    //是否已关闭
+	log         *Log                    //持久化日志，可选
+	codec       Codec                   //写入日志时的编解码
+	logMu       sync.Mutex              //开启日志后串行化发布
+	hooks       *hookChain[T]           //钩子
+}
+
+// 消息类型为 interface{} 的发布者，兼容原来的接口
 type Publisher struct {
-	m           sync.RWMutex             //读写锁
-	buffer      int                      //订阅队列的大小
-	timeout     time.Duration            //发布超时时间
-	subscribers map[subscriber]topicFunc //订阅者信息
+	*TypedPublisher[interface{}]
 }
 
 // 构建发布者对象，设置订阅队列的大小和超时时间
-func NewPublisher(buf int, t time.Duration) *Publisher {
-	return &Publisher{
+func NewPublisher(buf int, t time.Duration, opts ...Option) *Publisher {
+	return &Publisher{NewTypedPublisher[interface{}](buf, t, opts...)}
+}
+
+// 构建消息类型为 T 的发布者
+func NewTypedPublisher[T any](buf int, t time.Duration, opts ...Option) *TypedPublisher[T] {
+	o := publisherOptions{codec: JSONCodec{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &TypedPublisher[T]{
 		buffer:      buf,
 		timeout:     t,
-		subscribers: make(map[subscriber]topicFunc),
+		subscribers: make(map[chan T]*subState[T]),
+		patterns:    make(map[chan T]*subState[T]),
+		router:      newTopicTrie[T](),
+		log:         o.log,
+		codec:       o.codec,
+		hooks:       &hookChain[T]{},
 	}
 }
 
-// 添加一个订阅者，订阅指定的主题
-func (p *Publisher) SubscribeTopic(topic topicFunc) subscriber {
-	ch := make(subscriber, p.buffer)
+func (p *TypedPublisher[T]) newSubState(opts []SubscribeOption) *subState[T] {
+	return newSubState[T](p.buffer, opts)
+}
+
+// 登记订阅者并启动投递协程，发布者已关闭时订阅者会立即结束
+func (p *TypedPublisher[T]) register(s *subState[T]) error {
+	var segs []string
+	if s.pattern != "" {
+		var err error
+		if segs, err = splitTopic(s.pattern, true); err != nil {
+			return err
+		}
+	}
+
+	s.hooks = p.hooks
 	p.m.Lock()
 	defer p.m.Unlock()
-	p.subscribers[ch] = topic
-	return ch
+	if s.replay && p.log != nil {
+		s.log, s.codec = p.log, p.codec
+		s.replayTo = p.log.Latest()
+	} else {
+		s.replay = false
+	}
+	go s.run()
+	if p.closed {
+		s.stop(ErrClosed)
+		return ErrClosed
+	}
+	if segs != nil {
+		p.patterns[s.ch] = s
+		p.router.insert(segs, s)
+	} else {
+		p.subscribers[s.ch] = s
+	}
+	return nil
+}
+
+// 添加一个订阅者，订阅指定的主题
+func (p *Publisher) SubscribeTopic(topic topicFunc, opts ...SubscribeOption) subscriber {
+	s := p.newSubState(opts)
+	s.filter = topic
+	s.pattern = "" // 过滤器订阅者不走主题路由
+	_ = p.register(s)
+	return s.ch
 }
 
 // 添加一个订阅者，订阅所有的主题
-func (p *Publisher) Subscribe() subscriber {
-	return p.SubscribeTopic(nil)
+func (p *Publisher) Subscribe(opts ...SubscribeOption) subscriber {
+	return p.SubscribeTopic(nil, opts...)
+}
+
+// 添加一个订阅者，订阅命名主题，支持 * 和 # 通配符
+func (p *Publisher) SubscribePattern(pattern string, opts ...SubscribeOption) (subscriber, error) {
+	s := p.newSubState(opts)
+	s.pattern = pattern
+	if err := p.register(s); err != nil && err != ErrClosed {
+		return nil, err
+	}
+	return s.ch, nil
 }
 
-// 退出订阅, 同时关闭chan
+// 退出订阅, 投递协程退出时会关闭chan，重复退出或在 Close 之后退出都是安全的
+// 投递协程可能正在执行钩子，钩子里可能会调用发布者，所以要在释放锁之后再等它退出
 func (p *Publisher) Exit(sub subscriber) {
 	p.m.Lock()
-	defer p.m.Unlock()
-	delete(p.subscribers, sub)
-	close(sub)
+	s := p.remove(sub)
+	if s != nil {
+		s.stop(nil)
+	}
+	p.m.Unlock()
+	if s != nil {
+		<-s.done
+	}
 }
 
-// 关闭发布者，同时关闭所有订阅者通道
-func (p *Publisher) Close() {
+// 从过滤器订阅者或命名主题订阅者中移除，调用方需持有写锁
+func (p *TypedPublisher[T]) remove(sub chan T) *subState[T] {
+	if s, ok := p.patterns[sub]; ok {
+		segs, _ := splitTopic(s.pattern, true)
+		p.router.remove(segs, s)
+		delete(p.patterns, sub)
+		return s
+	}
+	if s, ok := p.subscribers[sub]; ok {
+		delete(p.subscribers, sub)
+		return s
+	}
+	return nil
+}
+
+// 把已经结束的订阅者摘掉，发布时只持有读锁，所以断开的订阅者只能异步摘除
+func (p *TypedPublisher[T]) detach(s *subState[T]) {
 	p.m.Lock()
 	defer p.m.Unlock()
+	if p.subscribers[s.ch] == s || p.patterns[s.ch] == s {
+		p.remove(s.ch)
+	}
+}
 
-	for sub := range p.subscribers {
-		delete(p.subscribers, sub)
-		close(sub)
+// 关闭发布者，同时关闭所有订阅者通道，重复关闭是安全的
+// 与 Exit 一样，释放锁之后才等待投递协程退出
+func (p *TypedPublisher[T]) Close() {
+	p.m.Lock()
+	p.closed = true
+	var stopped []*subState[T]
+	for _, subs := range []map[chan T]*subState[T]{p.subscribers, p.patterns} {
+		for sub := range subs {
+			s := p.remove(sub)
+			s.stop(ErrClosed)
+			stopped = append(stopped, s)
+		}
+	}
+	p.m.Unlock()
+
+	for _, s := range stopped {
+		<-s.done
 	}
 }
 
 // 发布主题
-func (p *Publisher) Publish(v interface{}) {
-	p.m.Lock()
-	defer p.m.Unlock()
-	var wg sync.WaitGroup
-	for sub, topic := range p.subscribers {
-		wg.Add(1)
-		go p.sendTopic(sub, topic, v, &wg) // 每个订阅者使用独立的goroutine,避免性能瓶颈
+func (p *TypedPublisher[T]) Publish(v T) {
+	_ = p.publish(nil, newEnvelope("", v))
+}
+
+// 发布主题，队列已满的订阅者一直等到 ctx 结束，而不是固定的 timeout
+// 有订阅者因为 ctx 结束没能入队时返回 ctx.Err()
+func (p *TypedPublisher[T]) PublishContext(ctx context.Context, v T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.publish(ctx, newEnvelope("", v))
+}
+
+// 发布到命名主题：前缀树中匹配的订阅者，以及过滤器通过的订阅者
+func (p *TypedPublisher[T]) PublishTo(topic string, v T) error {
+	err := p.publishTo(nil, topic, v)
+	if err == context.DeadlineExceeded { // 超时丢弃与 Publish 一样不算错误
+		return nil
 	}
-	wg.Wait()
+	return err
 }
 
-// 发送主题， 使用select语句处理channel， 允许超时
-func (p *Publisher) sendTopic(sub subscriber, topic topicFunc, v interface{}, wg *sync.WaitGroup) {
-	defer wg.Done()
-	if topic != nil && !topic(v) { // 先进行过滤器函数检查
+// 同 PublishTo，阻塞等待由 ctx 控制
+func (p *TypedPublisher[T]) PublishToContext(ctx context.Context, topic string, v T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.publishTo(ctx, topic, v)
+}
+
+func (p *TypedPublisher[T]) publishTo(ctx context.Context, topic string, v T) error {
+	if topic == "" {
+		return fmt.Errorf("%w: empty topic", ErrInvalidTopic)
+	}
+	return p.publish(ctx, newEnvelope(topic, v))
+}
+
+// 没有主题的信封只发给过滤器订阅者，有主题的还要发给前缀树中匹配的订阅者
+func (p *TypedPublisher[T]) publish(ctx context.Context, e *Envelope[T]) error {
+	var segs []string
+	if e.Topic != "" {
+		var err error
+		if segs, err = splitTopic(e.Topic, false); err != nil {
+			return err
+		}
+	}
+	if err := p.hooks.beforePublish(e); err != nil {
+		return err
+	}
+
+	var b batch[T]
+	// OnDrop 钩子可能会调用发布者(例如转发到死信主题)，等释放读锁之后再调用
+	defer b.dropped(p.hooks)
+	if p.log != nil {
+		// 开启日志后发布是串行的，等待期间也不能放开，否则日志的顺序和订阅者看到的顺序会不一致
+		p.logMu.Lock()
+		defer p.logMu.Unlock()
+	}
+	if err := p.offerAll(segs, e, &b); err != nil {
+		return err
+	}
+	// 读锁只在入队时持有，阻塞等待期间放开，否则排队的 Subscribe、Exit 会让所有发布者跟着等
+	// 每个 subState 有自己的锁，被退订时 quit 会让等待立即结束
+	return b.wait(ctx, p.timeout, e)
+}
+
+// 写日志并把消息放入所有匹配的订阅者的队列，持有读锁
+func (p *TypedPublisher[T]) offerAll(segs []string, e *Envelope[T], b *batch[T]) error {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	rpc := isRequestTraffic(e)
+	if p.log != nil && !rpc {
+		offset, err := p.appendLog(e.Topic, e.Payload)
+		if err != nil {
+			return err
+		}
+		// 在入队之前记下，所有订阅者看到的都是同一个信封
+		e.Offset, e.Logged = offset, true
+	}
+	if segs != nil {
+		p.router.match(segs, func(s *subState[T]) {
+			b.offer(p, s, e)
+		})
+	}
+	if rpc || isDeadLetter(e) {
+		return nil
+	}
+	for _, s := range p.subscribers {
+		b.offer(p, s, e)
+	}
+	return nil
+}
+
+// 一次发布涉及的订阅者中，队列已满需要阻塞等待的那部分，以及被丢弃的消息
+type batch[T any] struct {
+	blocked []*subState[T]
+	drops   []drop[T]
+}
+
+// 一条被丢弃的消息和原因
+type drop[T any] struct {
+	e      *Envelope[T]
+	reason error
+}
+
+// 把消息放入订阅者自己的队列，只有 PolicyBlock 且队列已满时才需要稍后等待
+func (b *batch[T]) offer(p *TypedPublisher[T], s *subState[T], e *Envelope[T]) {
+	if !s.accepts(e) { // 先进行过滤器函数检查
 		return
 	}
-	select {
-	case sub <- v: // 尝试发送
-	case <-time.After(p.timeout): // 超时放弃
+	s.mu.Lock()
+	res, dropped, reason := s.offerLocked(e)
+	s.mu.Unlock()
+	if dropped != nil {
+		b.drops = append(b.drops, drop[T]{e: dropped, reason: reason})
+	}
+	switch res {
+	case offerBlocked:
+		b.blocked = append(b.blocked, s)
+	case offerDisconnected:
+		go p.detach(s)
+	}
+}
+
+// 调用 OnDrop 钩子，调用方不能持有发布者的锁
+func (b *batch[T]) dropped(hooks *hookChain[T]) {
+	for _, d := range b.drops {
+		hooks.onDrop(d.e, d.reason)
+	}
+}
+
+// 所有阻塞的订阅者共享同一个 ctx，ctx 为 nil 时一次发布最多等待 timeout
+func (b *batch[T]) wait(ctx context.Context, timeout time.Duration, e *Envelope[T]) error {
+	if len(b.blocked) == 0 {
+		return nil
+	}
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+	}
+	var err error
+	for _, s := range b.blocked {
+		if !s.wait(e, ctx.Done()) {
+			b.drops = append(b.drops, drop[T]{e: e, reason: ErrExpired})
+			err = ctx.Err()
+		}
 	}
+	return err
 }
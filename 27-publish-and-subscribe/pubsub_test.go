@@ -1,6 +1,7 @@
 package pubsub
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
@@ -183,3 +184,61 @@ func TestConcurrency(t *testing.T) {
 
 	wg.Wait()
 }
+
+type order struct {
+	ID     int
+	Region string
+}
+
+// TestTypedPublisher 测试泛型发布者，订阅者直接收到 T，过滤器也是类型安全的
+func TestTypedPublisher(t *testing.T) {
+	p := NewTypedPublisher[order](4, 10*time.Millisecond)
+	defer p.Close()
+
+	all, err := p.SubscribeContext(context.Background(), WithPattern("orders.#"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eu, err := p.SubscribeFunc(context.Background(), func(o order) bool {
+		return o.Region == "eu"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 与 WithFilter 组合时两个过滤器都要通过
+	big, _ := p.SubscribeFunc(context.Background(), func(o order) bool {
+		return o.ID > 1
+	}, WithFilter(func(v interface{}) bool {
+		return v.(order).Region == "eu"
+	}))
+
+	_ = p.PublishTo("orders.created", order{ID: 1, Region: "eu"})
+	_ = p.PublishTo("orders.created", order{ID: 2, Region: "us"})
+	p.Publish(order{ID: 3, Region: "eu"})
+
+	var got order = <-all.C
+	if got.ID != 1 {
+		t.Errorf("expected order 1, got %+v", got)
+	}
+	if got = <-all.C; got.ID != 2 {
+		t.Errorf("expected order 2, got %+v", got)
+	}
+	if got = <-eu.C; got.ID != 1 {
+		t.Errorf("expected order 1, got %+v", got)
+	}
+	if got = <-eu.C; got.ID != 3 {
+		t.Errorf("expected order 3, got %+v", got)
+	}
+	if got = <-big.C; got.ID != 3 {
+		t.Errorf("expected order 3, got %+v", got)
+	}
+	delivered := func(st SubscriberStats) bool { return st.Delivered == 2 }
+	if st := waitStats(t, func() SubscriberStats { return p.Stats()[eu.C] }, delivered); !delivered(st) {
+		t.Errorf("expected 2 delivered, got %d", st.Delivered)
+	}
+
+	eu.Unsubscribe()
+	if _, ok := <-eu.C; ok {
+		t.Error("C should be closed after Unsubscribe")
+	}
+}
@@ -0,0 +1,177 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+/*
+基于持久化日志的回放
+设计思想：
+
+	1.NewPublisher 时通过 WithLog 挂上一个 Log，之后每条发布的消息都会先编码写入日志，再投递
+	2.订阅时通过 FromEarliest、FromOffset 指定起点，投递协程先从日志回放历史消息，再处理队列里的新消息
+	3.登记订阅者时持有写锁，记下此刻日志的末尾，回放只读到这里为止，之后的消息一定在队列里，不重不漏
+	4.开启日志后发布会被串行化，这样日志里的顺序就是订阅者看到的顺序
+	5.每条消息的 offset 记在信封的 Offset 上，实时投递和回放都带着，PublishLogged 把它返回给发布方，
+	  订阅者记下处理到的 offset，重启后用 FromOffset(offset+1) 接着消费
+	6.回放读日志出错时订阅结束，Err 返回这个错误，不会被当成没有历史消息
+*/
+var ErrNoLog = errors.New("pubsub: publisher has no log")
+
+// 消息的编解码，写入日志时使用，Unmarshal 与 json.Unmarshal 一样解码到 v 指向的值
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// 默认的 JSON 编解码
+// TypedPublisher[T] 回放时直接解码成 T；Publisher 回放出来的数字会变成 float64，对象会变成 map
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// 发布者的配置，与消息类型无关
+type publisherOptions struct {
+	log   *Log
+	codec Codec
+}
+
+// 发布者选项，函数式选项模式
+type Option func(*publisherOptions)
+
+// 把发布的消息写入日志，订阅者可以回放历史消息
+func WithLog(l *Log) Option {
+	return func(p *publisherOptions) {
+		p.log = l
+	}
+}
+
+// 写入日志时使用的编解码，默认 JSONCodec
+func WithCodec(c Codec) Option {
+	return func(p *publisherOptions) {
+		p.codec = c
+	}
+}
+
+// 从日志中最早保留的消息开始回放
+func FromEarliest() SubscribeOption {
+	return FromOffset(0)
+}
+
+// 从指定 offset 开始回放，已经被压缩掉的部分会跳过
+func FromOffset(offset uint64) SubscribeOption {
+	return func(s *subOptions) {
+		s.replay = true
+		s.replayFrom = offset
+	}
+}
+
+// 只接收订阅之后的新消息，这是默认行为
+func FromLatest() SubscribeOption {
+	return func(s *subOptions) {
+		s.replay = false
+	}
+}
+
+// 发布到命名主题并返回消息在日志中的 offset，没有开启日志时返回 ErrNoLog
+// 写入日志之后才失败(例如 ctx 结束时还有订阅者没能入队)时，offset 依然有效
+func (p *TypedPublisher[T]) PublishLogged(ctx context.Context, topic string, v T) (uint64, error) {
+	if p.log == nil {
+		return 0, ErrNoLog
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if topic == "" {
+		return 0, fmt.Errorf("%w: empty topic", ErrInvalidTopic)
+	}
+	e := newEnvelope(topic, v)
+	err := p.publish(ctx, e)
+	if !e.Logged {
+		return 0, err
+	}
+	return e.Offset, err
+}
+
+// 写入日志，返回 offset，调用方需持有 p.logMu
+func (p *TypedPublisher[T]) appendLog(topic string, v T) (uint64, error) {
+	data, err := p.codec.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	return p.log.Append(topic, data)
+}
+
+// 回放 [replayFrom, replayTo) 范围内匹配的历史消息，订阅者中途结束或读日志出错时返回 false
+func (s *subState[T]) replayLog() bool {
+	var route *topicTrie[T] // 只包含自己的前缀树，用来判断历史消息的主题是否匹配
+	if s.pattern != "" {
+		segs, _ := splitTopic(s.pattern, true)
+		route = newTopicTrie[T]()
+		route.insert(segs, s)
+	}
+
+	alive := true
+	err := s.log.readRange(s.replayFrom, s.replayTo, func(r Record) bool {
+		if route != nil {
+			topic, err := splitTopic(r.Topic, false)
+			if err != nil { // Publish 写入的消息没有主题
+				return true
+			}
+			matched := false
+			route.match(topic, func(*subState[T]) { matched = true })
+			if !matched {
+				return true
+			}
+		}
+		var v T
+		if err := s.codec.Unmarshal(r.Data, &v); err != nil {
+			s.mu.Lock()
+			s.dropped++
+			s.mu.Unlock()
+			return true
+		}
+		e := &Envelope[T]{Topic: r.Topic, Time: r.Time, Payload: v, Offset: r.Offset, Logged: true}
+		if !s.accepts(e) {
+			return true
+		}
+
+		var ch chan T
+		if s.envelopes == nil {
+			ch = s.ch
+		}
+		select {
+		case ch <- v:
+			s.replayed(e)
+			return true
+		case s.envelopes <- e:
+			s.replayed(e)
+			return true
+		case <-s.quit:
+			alive = false
+			return false
+		}
+	})
+	if err != nil && alive {
+		s.stop(fmt.Errorf("pubsub: replay: %w", err))
+		return false
+	}
+	return alive
+}
+
+// 回放的消息交给了消费者，不经过队列，只计入 Delivered
+func (s *subState[T]) replayed(e *Envelope[T]) {
+	s.mu.Lock()
+	s.delivered++
+	s.mu.Unlock()
+	s.hooks.afterDeliver(e)
+}
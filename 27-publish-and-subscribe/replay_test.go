@@ -0,0 +1,222 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newLoggedPublisher(t *testing.T) (*Publisher, *Log) {
+	t.Helper()
+	l, err := OpenLog(t.TempDir(), LogOptions{SegmentBytes: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return NewPublisher(8, time.Second, WithLog(l)), l
+}
+
+func expectMessages(t *testing.T, ch <-chan interface{}, want ...interface{}) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case v := <-ch:
+			if v != w {
+				t.Fatalf("expected %v, got %v", w, v)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %v", w)
+		}
+	}
+	select {
+	case v := <-ch:
+		t.Fatalf("unexpected message %v", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+// TestReplayFromEarliest 测试晚到的订阅者回放历史消息，并无缝衔接新消息
+func TestReplayFromEarliest(t *testing.T) {
+	p, _ := newLoggedPublisher(t)
+	defer p.Close()
+
+	_ = p.PublishTo("orders.eu", "a")
+	_ = p.PublishTo("users.eu", "b")
+	p.Publish("c")
+	_ = p.PublishTo("orders.us", "d")
+
+	orders, err := p.SubscribePattern("orders.*", FromEarliest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := p.Subscribe(FromEarliest())
+	_ = p.PublishTo("orders.eu", "e")
+
+	expectMessages(t, orders, "a", "d", "e")
+	expectMessages(t, all, "a", "b", "c", "d", "e")
+}
+
+// TestReplayFromOffset 测试从指定 offset 回放，以及默认只接收新消息
+func TestReplayFromOffset(t *testing.T) {
+	p, l := newLoggedPublisher(t)
+	defer p.Close()
+
+	for _, v := range []string{"a", "b", "c"} {
+		if err := p.PublishTo("t", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if l.Latest() != 3 {
+		t.Fatalf("expected 3 records in log, got %d", l.Latest())
+	}
+
+	sub, err := p.SubscribeContext(context.Background(), WithPattern("t"), FromOffset(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, _ := p.SubscribePattern("t")
+	_ = p.PublishTo("t", "d")
+
+	expectMessages(t, sub.C, "b", "c", "d")
+	expectMessages(t, latest, "d")
+}
+
+// TestReplayAfterCompaction 测试回放起点已经被压缩掉时从最早保留的消息开始
+func TestReplayAfterCompaction(t *testing.T) {
+	l, err := OpenLog(t.TempDir(), LogOptions{SegmentBytes: 64, RetentionBytes: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	p := NewPublisher(64, time.Second, WithLog(l))
+	defer p.Close()
+
+	for i := 0; i < 20; i++ {
+		_ = p.PublishTo("t", float64(i)) // JSONCodec 回放出来的数字是 float64
+	}
+	earliest := l.Earliest()
+	if earliest == 0 {
+		t.Fatal("expected old segments to be compacted")
+	}
+
+	sub, _ := p.SubscribePattern("t", FromOffset(0))
+	var want []interface{}
+	for i := earliest; i < 20; i++ {
+		want = append(want, float64(i))
+	}
+	expectMessages(t, sub, want...)
+}
+
+// TestReplayStopsOnExit 测试回放过程中退订不会阻塞
+func TestReplayStopsOnExit(t *testing.T) {
+	p, _ := newLoggedPublisher(t)
+	defer p.Close()
+
+	for i := 0; i < 100; i++ {
+		_ = p.PublishTo("t", "x")
+	}
+	sub, _ := p.SubscribePattern("t", FromEarliest())
+	<-sub
+
+	done := make(chan struct{})
+	go func() {
+		p.Exit(sub)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Exit blocked during replay")
+	}
+}
+
+// TestTypedReplay 测试泛型发布者回放时直接解码成 T
+func TestTypedReplay(t *testing.T) {
+	l, err := OpenLog(t.TempDir(), LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	p := NewTypedPublisher[order](4, time.Second, WithLog(l))
+	defer p.Close()
+
+	_ = p.PublishTo("orders.created", order{ID: 7, Region: "eu"})
+	sub, err := p.SubscribeContext(context.Background(), WithPattern("orders.#"), FromEarliest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case o := <-sub.C:
+		if o != (order{ID: 7, Region: "eu"}) {
+			t.Errorf("unexpected replayed order %+v", o)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for replay")
+	}
+}
+
+// TestReplayResumeFromEnvelopeOffset 测试发布方和订阅者都能拿到 offset，用它接着消费
+func TestReplayResumeFromEnvelopeOffset(t *testing.T) {
+	p, _ := newLoggedPublisher(t)
+	defer p.Close()
+	ctx := context.Background()
+
+	for i, v := range []string{"a", "b", "c"} {
+		off, err := p.PublishLogged(ctx, "t", v)
+		if err != nil || off != uint64(i) {
+			t.Fatalf("PublishLogged(%s) = %d, %v", v, off, err)
+		}
+	}
+
+	// 回放出来的信封带着 offset，处理完 b 之后"重启"
+	sub, err := p.SubscribeEnvelopes(ctx, WithPattern("t"), FromEarliest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last *Envelope[interface{}]
+	for i := 0; i < 2; i++ {
+		last = <-sub.C
+	}
+	sub.Unsubscribe()
+	if !last.Logged || last.Offset != 1 || last.Payload != "b" {
+		t.Fatalf("unexpected envelope %+v", last)
+	}
+
+	resumed, err := p.SubscribeEnvelopes(ctx, WithPattern("t"), FromOffset(last.Offset+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Unsubscribe()
+	_ = p.PublishTo("t", "d")
+	for _, want := range []uint64{2, 3} {
+		if e := <-resumed.C; !e.Logged || e.Offset != want {
+			t.Fatalf("expected offset %d, got %+v", want, e)
+		}
+	}
+
+	if _, err := NewPublisher(1, time.Second).PublishLogged(ctx, "t", 1); !errors.Is(err, ErrNoLog) {
+		t.Errorf("expected ErrNoLog, got %v", err)
+	}
+}
+
+// TestReplayError 测试读日志出错时订阅结束，Err 返回原因
+func TestReplayError(t *testing.T) {
+	p, l := newLoggedPublisher(t)
+	defer p.Close()
+	_ = p.PublishTo("t", "a")
+	l.Close()
+
+	sub, err := p.SubscribeContext(context.Background(), FromEarliest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("subscription should end when replay fails")
+	}
+	if !errors.Is(sub.Err(), ErrLogClosed) {
+		t.Errorf("expected ErrLogClosed, got %v", sub.Err())
+	}
+}
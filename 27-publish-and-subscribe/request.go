@@ -0,0 +1,103 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+请求/响应
+设计思想：
+
+	1.Request 先生成一个只属于这次请求的回复收件箱主题 _INBOX.xxx，用普通的订阅方式订阅它
+	2.把 RequestMessage 发布到目标主题，消息里带上收件箱
+	3.响应方从订阅的chan中收到 *RequestMessage，处理后调用 Respond 把结果发布到收件箱
+	4.收齐 n 个回复或 ctx 结束后退订收件箱，ctx 没有截止时间时最多等待发布者的 timeout
+	收件箱就是一个普通的命名主题订阅者，没有额外的关联表
+	请求和回复只路由给命名主题订阅者，不会发给过滤器订阅者，也不写入日志，
+	否则一个什么都收的 Subscribe 会收到别人的 *RequestMessage 和回复
+*/
+const inboxPrefix = "_INBOX"
+
+var ErrNoReply = errors.New("pubsub: request message has no reply inbox")
+
+// 请求消息
+type RequestMessage struct {
+	Topic   string      // 请求发往的主题
+	Reply   string      // 回复收件箱
+	Payload interface{} // 请求内容
+}
+
+// 生成全局唯一的收件箱主题
+func newInbox() string {
+	return inboxPrefix + "." + uniqueID()
+}
+
+// 是否是请求响应的消息：发往收件箱的回复，或者 *RequestMessage 请求
+func isRequestTraffic[T any](e *Envelope[T]) bool {
+	if strings.HasPrefix(e.Topic, inboxPrefix+".") {
+		return true
+	}
+	_, ok := interface{}(e.Payload).(*RequestMessage)
+	return ok
+}
+
+// 发送请求并等待第一个回复
+func (p *Publisher) Request(ctx context.Context, topic string, payload interface{}) (interface{}, error) {
+	replies, err := p.RequestN(ctx, topic, payload, 1)
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// 发送请求并等待 n 个回复，超时返回已经收到的回复和 ctx 的错误
+func (p *Publisher) RequestN(ctx context.Context, topic string, payload interface{}, n int) ([]interface{}, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("pubsub: invalid reply count %d", n)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	inbox := newInbox()
+	sub, err := p.SubscribeContext(ctx, WithPattern(inbox))
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+
+	req := &RequestMessage{Topic: topic, Reply: inbox, Payload: payload}
+	if err := p.PublishToContext(ctx, topic, req); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, 0, n)
+	for len(replies) < n {
+		select {
+		case v, ok := <-sub.C:
+			if !ok { // 发布者关闭或 ctx 结束
+				if err := sub.Err(); err != nil {
+					return replies, err
+				}
+				return replies, ErrClosed
+			}
+			replies = append(replies, v)
+		case <-ctx.Done():
+			return replies, ctx.Err()
+		}
+	}
+	return replies, nil
+}
+
+// 响应方使用：把回复发布到请求的收件箱
+func (p *Publisher) Respond(req *RequestMessage, v interface{}) error {
+	if req == nil || req.Reply == "" {
+		return ErrNoReply
+	}
+	return p.PublishTo(req.Reply, v)
+}
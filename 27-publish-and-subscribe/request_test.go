@@ -0,0 +1,120 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 启动一个响应者，把请求内容转成大写后回复
+func startResponder(t *testing.T, p *Publisher, pattern, prefix string) {
+	t.Helper()
+	sub, err := p.SubscribePattern(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for v := range sub {
+			req := v.(*RequestMessage)
+			_ = p.Respond(req, prefix+strings.ToUpper(req.Payload.(string)))
+		}
+	}()
+}
+
+// TestRequest 测试请求并等待第一个回复
+func TestRequest(t *testing.T) {
+	p := NewPublisher(4, time.Second)
+	defer p.Close()
+	startResponder(t, p, "svc.upper", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reply, err := p.Request(ctx, "svc.upper", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "HELLO" {
+		t.Errorf("expected HELLO, got %v", reply)
+	}
+	if len(p.patterns) != 1 {
+		t.Errorf("reply inbox should be unsubscribed, got %d named subscribers", len(p.patterns))
+	}
+}
+
+// TestRequestN 测试等待多个回复
+func TestRequestN(t *testing.T) {
+	p := NewPublisher(4, time.Second)
+	defer p.Close()
+	startResponder(t, p, "svc.*", "a:")
+	startResponder(t, p, "svc.upper", "b:")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	replies, err := p.RequestN(ctx, "svc.upper", "hi", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[interface{}]bool{}
+	for _, r := range replies {
+		got[r] = true
+	}
+	if len(replies) != 2 || !got["a:HI"] || !got["b:HI"] {
+		t.Errorf("unexpected replies %v", replies)
+	}
+}
+
+// TestRequestTimeout 测试没有响应者时按时返回
+func TestRequestTimeout(t *testing.T) {
+	p := NewPublisher(4, 20*time.Millisecond)
+	defer p.Close()
+	startResponder(t, p, "svc.upper", "")
+
+	// ctx 没有截止时间时使用发布者的 timeout
+	start := time.Now()
+	if _, err := p.Request(context.Background(), "svc.nobody", "x"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("request should time out quickly, took %v", d)
+	}
+
+	// 只来了一个回复
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	replies, err := p.RequestN(ctx, "svc.upper", "x", 2)
+	if !errors.Is(err, context.DeadlineExceeded) || len(replies) != 1 {
+		t.Errorf("expected one partial reply and DeadlineExceeded, got %v %v", replies, err)
+	}
+	if len(p.patterns) != 1 {
+		t.Errorf("reply inbox should be unsubscribed after timeout, got %d named subscribers", len(p.patterns))
+	}
+}
+
+// TestRespondWithoutInbox 测试没有收件箱的请求
+func TestRespondWithoutInbox(t *testing.T) {
+	p := NewPublisher(1, time.Second)
+	defer p.Close()
+	if err := p.Respond(&RequestMessage{Topic: "t"}, "x"); !errors.Is(err, ErrNoReply) {
+		t.Errorf("expected ErrNoReply, got %v", err)
+	}
+}
+
+// TestRequestHiddenFromFilterSubscribers 测试过滤器订阅者收不到请求和回复
+func TestRequestHiddenFromFilterSubscribers(t *testing.T) {
+	p := NewPublisher(4, time.Second)
+	defer p.Close()
+	all := p.Subscribe()
+	startResponder(t, p, "svc.upper", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := p.Request(ctx, "svc.upper", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	p.PublishTo("svc.other", "plain")
+	if v := <-all; v != "plain" {
+		t.Errorf("filter subscriber should only see plain messages, got %v", v)
+	}
+}
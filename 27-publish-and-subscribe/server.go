@@ -0,0 +1,240 @@
+package pubsub
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+/*
+网络桥接：服务端
+设计思想：
+
+	Server 把一个进程内的 Publisher 暴露到 TCP 上(线协议见 wire.go)
+	1.每个连接一个读协程，按帧处理 SUB、UNSUB、PUB、PING
+	2.每个 SUB 在 Publisher 上是一个普通的 Subscription，再起一个协程把消息编码成 MSG 帧写回去
+	3.连接断开时取消连接的 ctx，这个连接上的所有订阅自动退订
+	消息的编码使用 Publisher 的 Codec
+	每次写帧都有 writeTimeout 的截止时间，客户端不读时超时断开连接，它的订阅随之退订，
+	否则转发协程卡在写上，订阅者的队列被占满，本地所有发布者都要等满 timeout
+*/
+var ErrServerClosed = errors.New("pubsub: server closed")
+
+// 服务端选项
+type ServerOption func(*Server)
+
+// 写一个帧的超时时间，默认 5s，不大于0时不设截止时间
+func WithServerWriteTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.writeTimeout = d
+	}
+}
+
+type Server struct {
+	p            *Publisher
+	writeTimeout time.Duration
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*serverConn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+func NewServer(p *Publisher, opts ...ServerOption) *Server {
+	s := &Server{
+		p:            p,
+		writeTimeout: 5 * time.Second,
+		listeners:    make(map[net.Listener]struct{}),
+		conns:        make(map[*serverConn]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// 在 l 上接受连接，直到 l 出错或 Server 被关闭
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		c := &serverConn{
+			srv:    s,
+			conn:   conn,
+			ctx:    ctx,
+			cancel: cancel,
+			subs:   make(map[uint32]*Subscription),
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go c.serve()
+	}
+}
+
+// 关闭所有监听和连接，不会关闭 Publisher
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// 服务端的一个连接
+type serverConn struct {
+	srv    *Server
+	conn   net.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wmu        sync.Mutex // 写帧
+	mu         sync.Mutex
+	subs       map[uint32]*Subscription
+	forwarders sync.WaitGroup
+}
+
+func (c *serverConn) serve() {
+	defer func() {
+		c.cancel()
+		c.conn.Close()
+		c.mu.Lock()
+		subs := c.subs
+		c.subs = nil
+		c.mu.Unlock()
+		for _, sub := range subs { // 连接上的订阅全部退订，Close 返回时已经从发布者上移除
+			sub.Unsubscribe()
+		}
+		c.forwarders.Wait()
+		c.srv.mu.Lock()
+		delete(c.srv.conns, c)
+		c.srv.mu.Unlock()
+		c.srv.wg.Done()
+	}()
+
+	br := bufio.NewReader(c.conn)
+	for {
+		f, err := readFrame(br)
+		if err != nil {
+			return
+		}
+		c.handle(f)
+	}
+}
+
+func (c *serverConn) handle(f frame) {
+	p := c.srv.p
+	switch f.typ {
+	case frameSub:
+		c.unsubscribe(f.sid) // 同一个 sid 重复订阅时以最后一次为准
+		var opts []SubscribeOption
+		if f.topic != "" {
+			opts = append(opts, WithPattern(f.topic))
+		}
+		sub, err := p.SubscribeContext(c.ctx, opts...)
+		if err != nil {
+			c.write(frame{typ: frameErr, sid: f.sid, data: []byte(err.Error())})
+			return
+		}
+		c.mu.Lock()
+		c.subs[f.sid] = sub
+		c.mu.Unlock()
+		c.forwarders.Add(1)
+		go c.forward(f.sid, sub)
+	case frameUnsub:
+		c.unsubscribe(f.sid)
+	case framePub:
+		var v interface{}
+		err := p.codec.Unmarshal(f.data, &v)
+		if err == nil {
+			if f.topic == "" {
+				p.Publish(v)
+			} else {
+				err = p.PublishTo(f.topic, v)
+			}
+		}
+		if err != nil {
+			c.write(frame{typ: frameErr, data: []byte(err.Error())})
+		}
+	case framePing:
+		c.write(frame{typ: framePong})
+	}
+}
+
+func (c *serverConn) unsubscribe(sid uint32) {
+	c.mu.Lock()
+	sub, ok := c.subs[sid]
+	delete(c.subs, sid)
+	c.mu.Unlock()
+	if ok {
+		sub.Unsubscribe()
+	}
+}
+
+// 把订阅收到的消息编码成 MSG 帧推给客户端
+func (c *serverConn) forward(sid uint32, sub *Subscription) {
+	defer c.forwarders.Done()
+	for v := range sub.C {
+		data, err := c.srv.p.codec.Marshal(v)
+		if err != nil {
+			continue
+		}
+		if err := c.write(frame{typ: frameMsg, sid: sid, data: data}); err != nil {
+			return
+		}
+	}
+}
+
+// 写一个帧，失败或超时时断开连接，让读协程退出并清理
+func (c *serverConn) write(f frame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if d := c.srv.writeTimeout; d > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(d))
+	}
+	err := writeFrame(c.conn, f)
+	if err != nil {
+		// 写了一半的帧会让后面的帧错位，连接不能再用了
+		c.conn.Close()
+	}
+	return err
+}
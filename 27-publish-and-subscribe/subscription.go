@@ -0,0 +1,139 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+)
+
+/*
+订阅句柄
+设计思想：
+
+	Subscribe 只返回一个chan，退订全靠调用方记得调用 Exit，
+	Subscription 把chan和退订动作包在一起：
+		1. C 是只读的消息chan，订阅结束后会被关闭
+		2. Unsubscribe 可以重复调用
+		3. Done 在订阅结束后关闭，Err 说明结束的原因
+	SubscribeContext 在 ctx 结束时自动退订，订阅条件通过 WithFilter、WithPattern 选项指定
+	TypedPublisher[T] 的 SubscribeFunc 可以直接传入 func(T) bool 类型的过滤器
+*/
+var (
+	ErrClosed       = errors.New("pubsub: publisher closed")
+	ErrDisconnected = errors.New("pubsub: subscriber disconnected after too many drops")
+)
+
+type TypedSubscription[T any] struct {
+	C <-chan T
+	subHandle[T]
+}
+
+// 退订、查询状态等与 C 的类型无关的部分
+type subHandle[T any] struct {
+	p *TypedPublisher[T]
+	s *subState[T]
+}
+
+// Publisher 的订阅句柄
+type Subscription = TypedSubscription[interface{}]
+
+// 只接收过滤器通过的消息，可以与 WithPattern 组合使用
+func WithFilter(filter func(v interface{}) bool) SubscribeOption {
+	return func(s *subOptions) {
+		s.filter = filter
+	}
+}
+
+// 订阅命名主题，支持 * 和 # 通配符
+func WithPattern(pattern string) SubscribeOption {
+	return func(s *subOptions) {
+		s.pattern = pattern
+	}
+}
+
+// 把 WithFilter 的过滤器转成 func(T) bool，T 为 interface{} 时直接使用
+func typedFilter[T any](filter func(v interface{}) bool) func(T) bool {
+	if filter == nil {
+		return nil
+	}
+	if f, ok := interface{}(filter).(func(T) bool); ok {
+		return f
+	}
+	return func(v T) bool {
+		return filter(v)
+	}
+}
+
+// 添加一个订阅者，ctx 结束时自动退订
+func (p *TypedPublisher[T]) SubscribeContext(ctx context.Context, opts ...SubscribeOption) (*TypedSubscription[T], error) {
+	return p.subscribeTyped(ctx, p.newSubState(opts))
+}
+
+// 同 SubscribeContext，只接收 filter 返回 true 的消息，与 WithFilter 同时使用时两者都要通过
+func (p *TypedPublisher[T]) SubscribeFunc(ctx context.Context, filter func(v T) bool, opts ...SubscribeOption) (*TypedSubscription[T], error) {
+	s := p.newSubState(opts)
+	if prev := s.filter; prev != nil && filter != nil {
+		s.filter = func(v T) bool {
+			return prev(v) && filter(v)
+		}
+	} else if filter != nil {
+		s.filter = filter
+	}
+	return p.subscribeTyped(ctx, s)
+}
+
+func (p *TypedPublisher[T]) subscribeTyped(ctx context.Context, s *subState[T]) (*TypedSubscription[T], error) {
+	if err := p.subscribe(ctx, s); err != nil {
+		return nil, err
+	}
+	return &TypedSubscription[T]{C: s.ch, subHandle: subHandle[T]{p: p, s: s}}, nil
+}
+
+// 登记订阅者，ctx 结束时自动退订
+func (p *TypedPublisher[T]) subscribe(ctx context.Context, s *subState[T]) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := p.register(s); err != nil {
+		return err
+	}
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				p.unsubscribe(s, ctx.Err())
+			case <-s.done:
+			}
+		}()
+	}
+	return nil
+}
+
+// 退订并关闭 C，可以重复调用
+func (sub subHandle[T]) Unsubscribe() {
+	sub.p.unsubscribe(sub.s, nil)
+}
+
+// 订阅结束(退订、ctx结束、发布者关闭、被断开)后关闭
+func (sub subHandle[T]) Done() <-chan struct{} {
+	return sub.s.done
+}
+
+// 订阅结束的原因，主动退订或订阅尚未结束时为 nil
+func (sub subHandle[T]) Err() error {
+	sub.s.mu.Lock()
+	defer sub.s.mu.Unlock()
+	return sub.s.err
+}
+
+// 订阅者的统计信息
+func (sub subHandle[T]) Stats() SubscriberStats {
+	st, _ := sub.s.stats()
+	return st
+}
+
+func (p *TypedPublisher[T]) unsubscribe(s *subState[T], err error) {
+	s.stop(err)
+	p.detach(s)
+	<-s.done
+}
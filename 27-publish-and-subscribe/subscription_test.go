@@ -0,0 +1,142 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestSubscribeContextCancel 测试 ctx 取消后自动退订
+func TestSubscribeContextCancel(t *testing.T) {
+	p := NewPublisher(1, 10*time.Millisecond)
+	defer p.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := p.SubscribeContext(ctx, WithPattern("orders.#"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = p.PublishTo("orders.eu", "hello")
+	if v := <-sub.C; v != "hello" {
+		t.Errorf("expected hello, got %v", v)
+	}
+
+	cancel()
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("subscription should end after ctx is cancelled")
+	}
+	if _, ok := <-sub.C; ok {
+		t.Error("C should be closed")
+	}
+	if !errors.Is(sub.Err(), context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", sub.Err())
+	}
+	if len(p.Stats()) != 0 {
+		t.Error("subscriber should be removed from publisher")
+	}
+}
+
+// TestUnsubscribeIdempotent 测试重复退订、退订后关闭发布者都不会panic
+func TestUnsubscribeIdempotent(t *testing.T) {
+	p := NewPublisher(1, 10*time.Millisecond)
+
+	sub, err := p.SubscribeContext(context.Background(), WithFilter(func(v interface{}) bool {
+		return v == 1
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	if sub.Err() != nil {
+		t.Errorf("explicit unsubscribe should have nil Err, got %v", sub.Err())
+	}
+
+	ch := p.Subscribe()
+	p.Exit(ch)
+	p.Exit(ch)
+	p.Close()
+	p.Close()
+	p.Exit(ch)
+}
+
+// TestSubscribeAfterClose 测试关闭后订阅
+func TestSubscribeAfterClose(t *testing.T) {
+	p := NewPublisher(1, 10*time.Millisecond)
+	sub, _ := p.SubscribeContext(context.Background())
+	p.Close()
+
+	<-sub.Done()
+	if !errors.Is(sub.Err(), ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", sub.Err())
+	}
+	sub.Unsubscribe()
+
+	if _, err := p.SubscribeContext(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if _, ok := <-p.Subscribe(); ok {
+		t.Error("subscribing to a closed publisher should return a closed channel")
+	}
+}
+
+// TestSubscriptionDisconnected 测试被断开的订阅者可以从句柄上得知原因
+func TestSubscriptionDisconnected(t *testing.T) {
+	p := NewPublisher(1, 10*time.Millisecond)
+	defer p.Close()
+
+	sub, _ := p.SubscribeContext(context.Background(), WithDisconnectAfter(1))
+	p.Publish(1)
+	p.Publish(2)
+
+	<-sub.Done()
+	if !errors.Is(sub.Err(), ErrDisconnected) {
+		t.Errorf("expected ErrDisconnected, got %v", sub.Err())
+	}
+	if st := sub.Stats(); st.Enqueued != 1 || st.Delivered != 0 || st.Dropped != 1 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
+
+// TestPublishContext 测试发布时由 ctx 控制等待，而不是固定的 timeout
+func TestPublishContext(t *testing.T) {
+	p := NewPublisher(1, time.Hour)
+	defer p.Close()
+
+	sub := p.Subscribe()
+	if err := p.PublishContext(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := p.PublishContext(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("PublishContext should honor ctx, took %v", d)
+	}
+	if err := p.PublishToContext(ctx, "orders", 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected DeadlineExceeded for done ctx, got %v", err)
+	}
+
+	// 有消费者读取时，等待会在腾出空间后结束
+	done := make(chan error)
+	go func() {
+		done <- p.PublishContext(context.Background(), 4)
+	}()
+	if v := <-sub; v != 1 {
+		t.Errorf("expected 1, got %v", v)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if v := <-sub; v != 4 {
+		t.Errorf("expected 4, got %v", v)
+	}
+}
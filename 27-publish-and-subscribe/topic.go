@@ -0,0 +1,144 @@
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+命名主题与通配符
+设计思想：
+
+	主题使用 "." 分隔层级，例如 orders.eu.created
+	订阅时可以使用通配符：
+		*  匹配恰好一个层级，例如 orders.*.created
+		#  匹配零个或多个层级，例如 orders.#
+	所有命名订阅者挂在一棵按层级拆分的前缀树(trie)上，
+	发布时沿着主题的层级向下查找，只会访问到匹配的订阅者，而不是遍历全部订阅者
+*/
+const (
+	topicSep       = "."
+	wildcardOne    = "*"
+	wildcardSuffix = "#"
+)
+
+var ErrInvalidTopic = errors.New("pubsub: invalid topic")
+
+// 拆分主题，wildcard 为 true 时允许出现通配符（订阅），否则不允许（发布）
+func splitTopic(topic string, wildcard bool) ([]string, error) {
+	if topic == "" {
+		return nil, fmt.Errorf("%w: empty topic", ErrInvalidTopic)
+	}
+	segs := strings.Split(topic, topicSep)
+	for _, seg := range segs {
+		if seg == "" {
+			return nil, fmt.Errorf("%w: empty segment in %q", ErrInvalidTopic, topic)
+		}
+		if seg == wildcardOne || seg == wildcardSuffix {
+			if !wildcard {
+				return nil, fmt.Errorf("%w: wildcard in %q", ErrInvalidTopic, topic)
+			}
+			continue
+		}
+		// 通配符只能独占一个层级，a*.b 这种写法是非法的
+		if strings.ContainsAny(seg, wildcardOne+wildcardSuffix) {
+			return nil, fmt.Errorf("%w: bad segment %q in %q", ErrInvalidTopic, seg, topic)
+		}
+	}
+	return segs, nil
+}
+
+// 前缀树的节点，每一层对应主题的一个层级
+type topicNode[T any] struct {
+	children map[string]*topicNode[T]
+	subs     map[*subState[T]]struct{}
+}
+
+func newTopicNode[T any]() *topicNode[T] {
+	return &topicNode[T]{
+		children: make(map[string]*topicNode[T]),
+		subs:     make(map[*subState[T]]struct{}),
+	}
+}
+
+// 主题路由
+type topicTrie[T any] struct {
+	root *topicNode[T]
+}
+
+func newTopicTrie[T any]() *topicTrie[T] {
+	return &topicTrie[T]{root: newTopicNode[T]()}
+}
+
+func (t *topicTrie[T]) insert(segs []string, sub *subState[T]) {
+	n := t.root
+	for _, seg := range segs {
+		child, ok := n.children[seg]
+		if !ok {
+			child = newTopicNode[T]()
+			n.children[seg] = child
+		}
+		n = child
+	}
+	n.subs[sub] = struct{}{}
+}
+
+// 移除订阅者，并顺手剪掉已经没有订阅者的空分支
+func (t *topicTrie[T]) remove(segs []string, sub *subState[T]) {
+	path := make([]*topicNode[T], 0, len(segs)+1)
+	n := t.root
+	path = append(path, n)
+	for _, seg := range segs {
+		child, ok := n.children[seg]
+		if !ok {
+			return
+		}
+		n = child
+		path = append(path, n)
+	}
+	delete(n.subs, sub)
+
+	for i := len(segs); i > 0; i-- {
+		node := path[i]
+		if len(node.subs) > 0 || len(node.children) > 0 {
+			break
+		}
+		delete(path[i-1].children, segs[i-1])
+	}
+}
+
+// 查找与主题匹配的订阅者，同一个订阅者只会回调一次
+func (t *topicTrie[T]) match(segs []string, fn func(sub *subState[T])) {
+	seen := make(map[*subState[T]]struct{})
+	t.root.match(segs, seen)
+	for sub := range seen {
+		fn(sub)
+	}
+}
+
+func (n *topicNode[T]) match(segs []string, seen map[*subState[T]]struct{}) {
+	if len(segs) == 0 {
+		for sub := range n.subs {
+			seen[sub] = struct{}{}
+		}
+		// # 可以匹配零个层级，所以主题结束时还要继续看一眼 # 分支
+		if child, ok := n.children[wildcardSuffix]; ok {
+			child.match(nil, seen)
+		}
+		return
+	}
+
+	if child, ok := n.children[segs[0]]; ok {
+		child.match(segs[1:], seen)
+	}
+	if child, ok := n.children[wildcardOne]; ok {
+		child.match(segs[1:], seen)
+	}
+	if child, ok := n.children[wildcardSuffix]; ok {
+		// # 吞掉 0..len(segs) 个层级
+		for i := 0; i <= len(segs); i++ {
+			child.match(segs[i:], seen)
+		}
+	}
+}
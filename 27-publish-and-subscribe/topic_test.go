@@ -0,0 +1,138 @@
+package pubsub
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestTopicTrieMatch 测试前缀树的通配符匹配
+func TestTopicTrieMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"orders.eu.created", "orders.eu.created", true},
+		{"orders.eu.created", "orders.us.created", false},
+		{"orders.*.created", "orders.us.created", true},
+		{"orders.*.created", "orders.created", false},
+		{"orders.*", "orders.eu.created", false},
+		{"orders.#", "orders", true},
+		{"orders.#", "orders.eu.created", true},
+		{"#", "orders.eu.created", true},
+		{"orders.#.created", "orders.created", true},
+		{"orders.#.created", "orders.eu.fr.created", true},
+		{"orders.#.created", "orders.eu.deleted", false},
+		{"*.*.*", "orders.eu.created", true},
+		{"*.*.*", "orders.eu", false},
+	}
+
+	for _, tt := range tests {
+		trie := newTopicTrie[interface{}]()
+		sub := &subState[interface{}]{}
+		segs, err := splitTopic(tt.pattern, true)
+		if err != nil {
+			t.Fatalf("splitTopic(%q): %v", tt.pattern, err)
+		}
+		trie.insert(segs, sub)
+
+		got := false
+		topic, _ := splitTopic(tt.topic, false)
+		trie.match(topic, func(*subState[interface{}]) { got = true })
+		if got != tt.want {
+			t.Errorf("pattern %q topic %q: got %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+// TestTopicTrieRemove 测试移除订阅者后空分支会被剪掉
+func TestTopicTrieRemove(t *testing.T) {
+	trie := newTopicTrie[interface{}]()
+	a, b := &subState[interface{}]{}, &subState[interface{}]{}
+	segsA, _ := splitTopic("orders.eu.created", true)
+	segsB, _ := splitTopic("orders.#", true)
+	trie.insert(segsA, a)
+	trie.insert(segsB, b)
+
+	trie.remove(segsA, a)
+	if _, ok := trie.root.children["orders"].children["eu"]; ok {
+		t.Error("empty branch orders.eu should be pruned")
+	}
+	trie.remove(segsB, b)
+	if len(trie.root.children) != 0 {
+		t.Error("trie should be empty after removing all subscribers")
+	}
+}
+
+// TestSplitTopicInvalid 测试非法主题
+func TestSplitTopicInvalid(t *testing.T) {
+	for _, topic := range []string{"", "orders..created", "orders.", "orders.e*"} {
+		if _, err := splitTopic(topic, true); !errors.Is(err, ErrInvalidTopic) {
+			t.Errorf("pattern %q: expected ErrInvalidTopic, got %v", topic, err)
+		}
+	}
+	if _, err := splitTopic("orders.*", false); !errors.Is(err, ErrInvalidTopic) {
+		t.Errorf("wildcard should not be allowed when publishing, got %v", err)
+	}
+}
+
+// TestPublishTo 测试命名主题的发布订阅，以及与过滤器订阅者共存
+func TestPublishTo(t *testing.T) {
+	p := NewPublisher(1, 10*time.Millisecond)
+	defer p.Close()
+
+	eu, err := p.SubscribePattern("orders.eu.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := p.SubscribePattern("orders.#")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pred := p.Subscribe()
+
+	if err := p.PublishTo("orders.us.created", "us"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-eu:
+		t.Errorf("orders.eu.* should not receive %v", msg)
+	default:
+	}
+	if msg := <-all; msg != "us" {
+		t.Errorf("orders.# expected 'us', got %v", msg)
+	}
+	if msg := <-pred; msg != "us" {
+		t.Errorf("predicate subscriber expected 'us', got %v", msg)
+	}
+
+	// 普通 Publish 不会投递给命名主题订阅者
+	p.Publish("plain")
+	select {
+	case msg := <-all:
+		t.Errorf("named subscriber should not receive plain publish, got %v", msg)
+	default:
+	}
+	<-pred
+
+	if err := p.PublishTo("orders.*", "bad"); !errors.Is(err, ErrInvalidTopic) {
+		t.Errorf("expected ErrInvalidTopic, got %v", err)
+	}
+}
+
+// TestExitPattern 测试命名主题订阅者退出
+func TestExitPattern(t *testing.T) {
+	p := NewPublisher(1, 10*time.Millisecond)
+	defer p.Close()
+
+	sub, _ := p.SubscribePattern("orders.#")
+	p.Exit(sub)
+	if _, ok := <-sub; ok {
+		t.Fatal("expected channel to be closed after Exit()")
+	}
+	if len(p.patterns) != 0 || len(p.router.root.children) != 0 {
+		t.Error("named subscriber should be removed from router")
+	}
+}
@@ -0,0 +1,163 @@
+package pubsub
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+网络桥接的线协议
+设计思想：
+
+	每个帧都是 长度(4) | 类型(1) | 内容，长度不包含自身，内容按类型决定：
+		SUB    sid(4) | 主题长度(2) | 主题      订阅，主题为空表示订阅所有消息
+		UNSUB  sid(4)                          退订
+		PUB    主题长度(2) | 主题 | 数据        发布，主题为空等同于 Publish
+		MSG    sid(4) | 数据                   服务端把消息推给订阅者
+		PING / PONG                            心跳
+		ERR    sid(4) | 错误信息                服务端处理某个订阅失败
+	sid 由客户端分配，断线重连后客户端用原来的 sid 重新订阅
+*/
+type frameType byte
+
+const (
+	frameSub frameType = iota + 1
+	frameUnsub
+	framePub
+	frameMsg
+	framePing
+	framePong
+	frameErr
+)
+
+const maxFrameSize = 16 << 20
+
+var ErrBadFrame = errors.New("pubsub: malformed frame")
+
+func (t frameType) String() string {
+	switch t {
+	case frameSub:
+		return "SUB"
+	case frameUnsub:
+		return "UNSUB"
+	case framePub:
+		return "PUB"
+	case frameMsg:
+		return "MSG"
+	case framePing:
+		return "PING"
+	case framePong:
+		return "PONG"
+	case frameErr:
+		return "ERR"
+	}
+	return fmt.Sprintf("frame(%d)", byte(t))
+}
+
+// 每种帧包含哪些字段
+func (t frameType) layout() (sid, topic, data bool) {
+	switch t {
+	case frameSub:
+		return true, true, false
+	case frameUnsub:
+		return true, false, false
+	case framePub:
+		return false, true, true
+	case frameMsg, frameErr:
+		return true, false, true
+	}
+	return false, false, false
+}
+
+type frame struct {
+	typ   frameType
+	sid   uint32
+	topic string // SUB 的订阅主题，PUB 的发布主题
+	data  []byte // PUB、MSG 的消息，ERR 的错误信息
+}
+
+func writeFrame(w io.Writer, f frame) error {
+	hasSID, hasTopic, hasData := f.typ.layout()
+	size := 1
+	if hasSID {
+		size += 4
+	}
+	if hasTopic {
+		if len(f.topic) > 1<<16-1 {
+			return fmt.Errorf("%w: topic too long", ErrBadFrame)
+		}
+		size += 2 + len(f.topic)
+	}
+	if hasData {
+		size += len(f.data)
+	}
+	if size > maxFrameSize {
+		return fmt.Errorf("%w: frame too large (%d bytes)", ErrBadFrame, size)
+	}
+
+	buf := make([]byte, 4+size)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(size))
+	buf[4] = byte(f.typ)
+	pos := 5
+	if hasSID {
+		binary.BigEndian.PutUint32(buf[pos:], f.sid)
+		pos += 4
+	}
+	if hasTopic {
+		binary.BigEndian.PutUint16(buf[pos:], uint16(len(f.topic)))
+		pos += 2
+		pos += copy(buf[pos:], f.topic)
+	}
+	if hasData {
+		copy(buf[pos:], f.data)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader) (frame, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return frame{}, err
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size < 1 || size > maxFrameSize {
+		return frame{}, fmt.Errorf("%w: bad size %d", ErrBadFrame, size)
+	}
+	body := make([]byte, size-1)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return frame{}, err
+	}
+
+	f := frame{typ: frameType(header[4])}
+	hasSID, hasTopic, hasData := f.typ.layout()
+	if f.typ < frameSub || f.typ > frameErr {
+		return frame{}, fmt.Errorf("%w: unknown type %d", ErrBadFrame, header[4])
+	}
+	if hasSID {
+		if len(body) < 4 {
+			return frame{}, fmt.Errorf("%w: short %v", ErrBadFrame, f.typ)
+		}
+		f.sid = binary.BigEndian.Uint32(body)
+		body = body[4:]
+	}
+	if hasTopic {
+		if len(body) < 2 {
+			return frame{}, fmt.Errorf("%w: short %v", ErrBadFrame, f.typ)
+		}
+		n := int(binary.BigEndian.Uint16(body))
+		if len(body) < 2+n {
+			return frame{}, fmt.Errorf("%w: short %v", ErrBadFrame, f.typ)
+		}
+		f.topic = string(body[2 : 2+n])
+		body = body[2+n:]
+	}
+	if hasData {
+		f.data = body
+	} else if len(body) != 0 {
+		return frame{}, fmt.Errorf("%w: trailing bytes in %v", ErrBadFrame, f.typ)
+	}
+	return f, nil
+}
@@ -0,0 +1,80 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// TestFrameRoundTrip 测试每种帧编码后能原样解码
+func TestFrameRoundTrip(t *testing.T) {
+	frames := []frame{
+		{typ: frameSub, sid: 1, topic: "orders.#"},
+		{typ: frameSub, sid: 2},
+		{typ: frameUnsub, sid: 3},
+		{typ: framePub, topic: "orders.eu", data: []byte(`"hello"`)},
+		{typ: framePub, data: []byte(`1`)},
+		{typ: frameMsg, sid: 4, data: []byte(`{"a":1}`)},
+		{typ: framePing},
+		{typ: framePong},
+		{typ: frameErr, sid: 5, data: []byte("bad pattern")},
+	}
+
+	var buf bytes.Buffer
+	for _, f := range frames {
+		if err := writeFrame(&buf, f); err != nil {
+			t.Fatalf("write %v: %v", f.typ, err)
+		}
+	}
+	for _, want := range frames {
+		got, err := readFrame(&buf)
+		if err != nil {
+			t.Fatalf("read %v: %v", want.typ, err)
+		}
+		if len(want.data) == 0 {
+			want.data = nil
+		}
+		if len(got.data) == 0 {
+			got.data = nil
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	}
+	if _, err := readFrame(&buf); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+// TestReadMalformedFrame 测试非法的帧
+func TestReadMalformedFrame(t *testing.T) {
+	raw := func(typ byte, body ...byte) []byte {
+		b := make([]byte, 5, 5+len(body))
+		binary.BigEndian.PutUint32(b, uint32(1+len(body)))
+		b[4] = typ
+		return append(b, body...)
+	}
+
+	tests := map[string][]byte{
+		"zero size":      {0, 0, 0, 0, 1},
+		"too large":      {0xff, 0xff, 0xff, 0xff, 1},
+		"unknown type":   raw(99),
+		"short sid":      raw(byte(frameUnsub), 0, 0),
+		"short topic":    raw(byte(frameSub), 0, 0, 0, 1, 0, 5, 'a'),
+		"trailing bytes": raw(byte(framePing), 1),
+	}
+	for name, b := range tests {
+		if _, err := readFrame(bytes.NewReader(b)); !errors.Is(err, ErrBadFrame) {
+			t.Errorf("%s: expected ErrBadFrame, got %v", name, err)
+		}
+	}
+
+	// 帧被截断
+	b := raw(byte(frameMsg), 0, 0, 0, 1, 'x')
+	if _, err := readFrame(bytes.NewReader(b[:len(b)-1])); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/sevenelevenlee/go-patterns
 
-go 1.16
+go 1.18